@@ -0,0 +1,179 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// adaptiveInterval is the minimum time between two level adjustments.
+	adaptiveInterval time.Duration = 100 * time.Millisecond
+	// adaptiveLatency is the default compression latency above which the
+	// level is lowered.
+	adaptiveLatency time.Duration = 10 * time.Millisecond
+)
+
+// levelOrder lists usable compression levels from the fastest to the one
+// yielding the best compression.
+var levelOrder = []int{flate.HuffmanOnly, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+// AdaptiveLevel is a controller that adjusts the compression level to the
+// current load. It tracks the number of compressions in flight and the recent
+// compression latency and steps the level down when either exceeds its target,
+// and back up when both are well below them.
+//
+// AdaptiveLevel is safe for concurrent use and can be shared by several
+// middleware instances.
+type AdaptiveLevel struct {
+	// levels is a list of levels the controller steps through, starting with
+	// the one yielding the best compression.
+	levels []int
+	// skip allows the controller to step past the last level and skip
+	// compression altogether.
+	skip bool
+	// maxInFlight is the targeted maximum number of compressions in flight.
+	maxInFlight int64
+	// maxLatency is the targeted maximum compression latency.
+	maxLatency time.Duration
+
+	// step is the index of the current level in levels. A value equal to the
+	// length of levels means compression is skipped.
+	step atomic.Int64
+	// inFlight is the number of compressions in progress.
+	inFlight atomic.Int64
+	// latency is an exponentially weighted moving average of compression
+	// latency in nanoseconds.
+	latency atomic.Int64
+	// observed is set when latency was updated since the last adjustment.
+	observed atomic.Bool
+	// adjusted is the time of the last adjustment in Unix nanoseconds.
+	adjusted atomic.Int64
+}
+
+// NewAdaptiveLevel returns a controller that keeps the compression level
+// between min and max. Levels follow the same rules as for
+// NewCompressWithCompressionLevel, with flate.HuffmanOnly being the fastest
+// level the controller can step down to. By default the controller targets at
+// most one compression in flight per CPU and at most 10 milliseconds per
+// compression.
+func NewAdaptiveLevel(min, max int) *AdaptiveLevel {
+	lo, hi := levelIndex(min), levelIndex(max)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	levels := make([]int, 0, hi-lo+1)
+	for i := hi; i >= lo; i-- {
+		levels = append(levels, levelOrder[i])
+	}
+
+	return &AdaptiveLevel{
+		levels:      levels,
+		maxInFlight: int64(runtime.NumCPU()),
+		maxLatency:  adaptiveLatency,
+	}
+}
+
+// levelIndex returns the position of level in levelOrder. Unknown levels are
+// clamped to the nearest usable one.
+func levelIndex(level int) int {
+	switch {
+	case level == flate.DefaultCompression:
+		level = 6
+	case level < flate.HuffmanOnly || level == flate.NoCompression:
+		return 0
+	case level > flate.BestCompression:
+		level = flate.BestCompression
+	}
+
+	for i, l := range levelOrder {
+		if l == level {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// SetTargets sets the targeted maximum number of compressions in flight and
+// compression latency.
+func (a *AdaptiveLevel) SetTargets(inFlight int, latency time.Duration) {
+	if inFlight < 1 {
+		inFlight = 1
+	}
+
+	a.maxInFlight, a.maxLatency = int64(inFlight), latency
+}
+
+// SetSkip allows the controller to skip compression altogether when the load
+// stays too high even at the fastest level.
+func (a *AdaptiveLevel) SetSkip(skip bool) {
+	a.skip = skip
+}
+
+// Level returns the compression level to use right now. It returns false if
+// compression should be skipped.
+func (a *AdaptiveLevel) Level() (int, bool) {
+	a.adjust(time.Now())
+	step := int(a.step.Load())
+	if step >= len(a.levels) {
+		return 0, false
+	}
+
+	return a.levels[step], true
+}
+
+// begin records the start of a compression.
+func (a *AdaptiveLevel) begin() {
+	a.inFlight.Add(1)
+}
+
+// end records the end of a compression that took d.
+func (a *AdaptiveLevel) end(d time.Duration) {
+	a.inFlight.Add(-1)
+	for {
+		old := a.latency.Load()
+		if a.latency.CompareAndSwap(old, old+(int64(d)-old)/5) {
+			break
+		}
+	}
+	a.observed.Store(true)
+}
+
+// adjust moves the level one step down if the load is above target or one step
+// up if it is well below target. It does nothing if the level was adjusted less
+// than adaptiveInterval ago.
+func (a *AdaptiveLevel) adjust(now time.Time) {
+	last := a.adjusted.Load()
+	if now.UnixNano()-last < int64(adaptiveInterval) || !a.adjusted.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	// Let latency decay while no compressions finish, so the level can recover
+	// after compression was skipped or traffic went idle.
+	if !a.observed.Swap(false) {
+		a.latency.Store(a.latency.Load() / 2)
+	}
+
+	steps := int64(len(a.levels))
+	if a.skip {
+		steps++
+	}
+	inFlight, latency, step := a.inFlight.Load(), time.Duration(a.latency.Load()), a.step.Load()
+	switch {
+	case inFlight > a.maxInFlight || latency > a.maxLatency:
+		if step < steps-1 {
+			a.step.Store(step + 1)
+		}
+	case inFlight <= a.maxInFlight/2 && latency <= a.maxLatency/2:
+		if step > 0 {
+			a.step.Store(step - 1)
+		}
+	}
+}
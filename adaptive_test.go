@@ -0,0 +1,132 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAdaptiveLevel(t *testing.T) {
+	for _, e := range []struct {
+		min, max int
+		levels   []int
+	}{
+		{1, 3, []int{3, 2, 1}},
+		{3, 1, []int{3, 2, 1}},
+		{flate.HuffmanOnly, 2, []int{2, 1, flate.HuffmanOnly}},
+		{flate.NoCompression, 1, []int{1, flate.HuffmanOnly}},
+		{8, 20, []int{9, 8}},
+		{flate.DefaultCompression, flate.DefaultCompression, []int{6}},
+	} {
+		a := NewAdaptiveLevel(e.min, e.max)
+		if len(a.levels) != len(e.levels) {
+			t.Errorf(`negronicompress.NewAdaptiveLevel(%d, %d).levels = %v, want %v`, e.min, e.max, a.levels, e.levels)
+			continue
+		}
+		for i := range e.levels {
+			if a.levels[i] != e.levels[i] {
+				t.Errorf(`negronicompress.NewAdaptiveLevel(%d, %d).levels = %v, want %v`, e.min, e.max, a.levels, e.levels)
+				break
+			}
+		}
+	}
+}
+
+func TestAdaptiveLevel_Adjust(t *testing.T) {
+	a := NewAdaptiveLevel(flate.HuffmanOnly, 2)
+	a.SetTargets(2, 10*time.Millisecond)
+	a.SetSkip(true)
+
+	if l, ok := a.Level(); !ok || l != 2 {
+		t.Fatalf(`negronicompress.AdaptiveLevel.Level() = %d, %t; want %d, true`, l, ok, 2)
+	}
+	now := time.Unix(0, a.adjusted.Load())
+
+	// Too many compressions in flight steps the level down up to skipping.
+	for i := 0; i < 3; i++ {
+		a.begin()
+	}
+	for _, e := range []int{1, flate.HuffmanOnly, 0, 0} {
+		now = now.Add(adaptiveInterval)
+		a.adjust(now)
+		l, ok := a.levels[0], true
+		if s := int(a.step.Load()); s < len(a.levels) {
+			l = a.levels[s]
+		} else {
+			ok = false
+		}
+		if e == 0 && ok || e != 0 && l != e {
+			t.Errorf(`negronicompress.AdaptiveLevel level = %d, %t; want %d`, l, ok, e)
+		}
+	}
+
+	// Adjustments are rate limited.
+	a.adjust(now.Add(adaptiveInterval / 2))
+	if s := a.step.Load(); s != 3 {
+		t.Errorf(`negronicompress.AdaptiveLevel.step = %d, want %d`, s, 3)
+	}
+
+	// Slow compressions keep the level down even when in flight count drops.
+	for i := 0; i < 3; i++ {
+		a.end(time.Second)
+	}
+	now = now.Add(adaptiveInterval)
+	a.adjust(now)
+	if s := a.step.Load(); s != 3 {
+		t.Errorf(`negronicompress.AdaptiveLevel.step = %d, want %d`, s, 3)
+	}
+
+	// Idle controller lets latency decay and steps back up.
+	for i := 0; i < 20; i++ {
+		now = now.Add(adaptiveInterval)
+		a.adjust(now)
+	}
+	if s := a.step.Load(); s != 0 {
+		t.Errorf(`negronicompress.AdaptiveLevel.step = %d, want %d`, s, 0)
+	}
+}
+
+func TestCompress_SetAdaptiveLevel(t *testing.T) {
+	a := NewAdaptiveLevel(1, 1)
+	a.SetSkip(true)
+	a.step.Store(1)
+	a.adjusted.Store(time.Now().Add(time.Hour).UnixNano())
+
+	handler := NewCompress()
+	handler.SetAdaptiveLevel(a)
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	ctx, res := NewResultContext(req.Context())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	if res.Skipped != SkipOverload || w.Body.String() != cnt {
+		t.Errorf(`negronicompress.Result.Skipped = %q, want %q`, res.Skipped, SkipOverload)
+	}
+
+	a.step.Store(0)
+	ctx, res = NewResultContext(req.Context())
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	if res.Encoding != headerGzip {
+		t.Errorf(`negronicompress.Result.Encoding = %q, want %q`, res.Encoding, headerGzip)
+	}
+	if n := a.inFlight.Load(); n != 0 {
+		t.Errorf(`negronicompress.AdaptiveLevel.inFlight = %d, want %d`, n, 0)
+	}
+	if a.latency.Load() == 0 {
+		t.Error(`negronicompress.AdaptiveLevel.latency was not updated`)
+	}
+}
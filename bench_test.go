@@ -0,0 +1,119 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// benchWords are the words benchmark text content is made of.
+var benchWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua`)
+
+// benchPayloads are the kinds of content benchmarks are run with.
+var benchPayloads = []struct {
+	name, contentType string
+	content           func(src *rand.ChaCha8, size int) []byte
+}{
+	{`html`, `text/html; charset=utf-8`, func(src *rand.ChaCha8, size int) []byte {
+		r := rand.New(src)
+		var b strings.Builder
+		for b.Len() < size {
+			fmt.Fprintf(&b, `<p class="item-%d">%s %s</p>`, r.IntN(100), benchWords[r.IntN(len(benchWords))], benchWords[r.IntN(len(benchWords))])
+		}
+		return []byte(b.String()[:size])
+	}},
+	{`json`, `application/json`, func(src *rand.ChaCha8, size int) []byte {
+		r := rand.New(src)
+		var b strings.Builder
+		for b.Len() < size {
+			fmt.Fprintf(&b, `{"id":%d,"name":%q,"score":%.3f},`, r.IntN(1e6), benchWords[r.IntN(len(benchWords))], r.Float64())
+		}
+		return []byte(b.String()[:size])
+	}},
+	{`random`, `application/octet-stream`, func(src *rand.ChaCha8, size int) []byte {
+		b := make([]byte, size)
+		src.Read(b)
+		return b
+	}},
+}
+
+// benchSizes are the content sizes benchmarks are run with.
+var benchSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// benchResponseWriter is a http.ResponseWriter discarding everything written
+// to it.
+type benchResponseWriter struct {
+	header http.Header
+}
+
+// Header implements http.ResponseWriter.
+func (w *benchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter.
+func (w *benchResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *benchResponseWriter) WriteHeader(int) {}
+
+// benchServeHTTP measures handler serving content of contentType to clients
+// sending acceptEncoding.
+func benchServeHTTP(b *testing.B, handler *compress, content []byte, contentType, acceptEncoding string) {
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, acceptEncoding)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentType)
+		w.Write(content)
+	}
+
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(&benchResponseWriter{header: http.Header{}}, req, next)
+	}
+}
+
+func BenchmarkCompress_ServeHTTP(b *testing.B) {
+	handler := NewCompress()
+	handler.AddContentType(`application/json`, `application/octet-stream`)
+
+	for _, p := range benchPayloads {
+		for _, size := range benchSizes {
+			content := p.content(rand.NewChaCha8([32]byte{1}), size)
+			for _, encoding := range []string{headerIdentity, headerGzip, headerDeflate} {
+				b.Run(fmt.Sprintf(`%s/%dKiB/%s`, p.name, size>>10, encoding), func(b *testing.B) {
+					benchServeHTTP(b, handler, content, p.contentType, encoding)
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkCompress_ServeHTTPLevel(b *testing.B) {
+	content := benchPayloads[0].content(rand.NewChaCha8([32]byte{1}), 64<<10)
+	for _, e := range []struct {
+		name  string
+		level int
+	}{
+		{`huffman`, flate.HuffmanOnly},
+		{`speed`, flate.BestSpeed},
+		{`default`, flate.DefaultCompression},
+		{`best`, flate.BestCompression},
+	} {
+		handler := NewCompressWithCompressionLevel(e.level)
+		b.Run(e.name, func(b *testing.B) {
+			benchServeHTTP(b, handler, content, benchPayloads[0].contentType, headerGzip)
+		})
+	}
+}
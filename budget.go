@@ -0,0 +1,73 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import "sync/atomic"
+
+// Budget limits resources used by buffered compression. It caps the total
+// number of bytes held in response buffers, both original and compressed, and
+// the number of compressions running at the same time. Responses that would
+// exceed the budget are sent uncompressed.
+//
+// Budget is safe for concurrent use and is meant to be shared by all middleware
+// instances in a process.
+type Budget struct {
+	// maxBytes is the maximum number of buffered bytes. Zero means no limit.
+	maxBytes int64
+	// maxConcurrent is the maximum number of concurrent compressions. Zero
+	// means no limit.
+	maxConcurrent int64
+	// bytes is the number of bytes currently buffered.
+	bytes atomic.Int64
+	// concurrent is the number of compressions currently running.
+	concurrent atomic.Int64
+}
+
+// NewBudget returns a new budget allowing at most maxBytes buffered bytes and
+// at most maxConcurrent concurrent compressions. Zero disables either limit.
+func NewBudget(maxBytes int64, maxConcurrent int) *Budget {
+	return &Budget{maxBytes: maxBytes, maxConcurrent: int64(maxConcurrent)}
+}
+
+// Bytes returns the number of bytes currently buffered.
+func (b *Budget) Bytes() int64 {
+	return b.bytes.Load()
+}
+
+// Concurrent returns the number of compressions currently running.
+func (b *Budget) Concurrent() int {
+	return int(b.concurrent.Load())
+}
+
+// reserve reserves n bytes. It returns false if that would exceed the limit.
+func (b *Budget) reserve(n int) bool {
+	if b.bytes.Add(int64(n)) > b.maxBytes && b.maxBytes > 0 {
+		b.bytes.Add(-int64(n))
+		return false
+	}
+
+	return true
+}
+
+// release returns n previously reserved bytes.
+func (b *Budget) release(n int) {
+	b.bytes.Add(-int64(n))
+}
+
+// acquire reserves a slot for a single compression. It returns false if no
+// slot is free.
+func (b *Budget) acquire() bool {
+	if b.concurrent.Add(1) > b.maxConcurrent && b.maxConcurrent > 0 {
+		b.concurrent.Add(-1)
+		return false
+	}
+
+	return true
+}
+
+// done frees a slot reserved with acquire.
+func (b *Budget) done() {
+	b.concurrent.Add(-1)
+}
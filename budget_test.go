@@ -0,0 +1,94 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(10, 1)
+	if !b.reserve(6) || b.reserve(5) || !b.reserve(4) {
+		t.Errorf(`negronicompress.Budget.reserve() did not respect limit of %d bytes`, 10)
+	}
+	if n := b.Bytes(); n != 10 {
+		t.Errorf(`negronicompress.Budget.Bytes() = %d, want %d`, n, 10)
+	}
+	b.release(10)
+	if n := b.Bytes(); n != 0 {
+		t.Errorf(`negronicompress.Budget.Bytes() = %d, want %d`, n, 0)
+	}
+
+	if !b.acquire() || b.acquire() {
+		t.Errorf(`negronicompress.Budget.acquire() did not respect limit of %d`, 1)
+	}
+	if n := b.Concurrent(); n != 1 {
+		t.Errorf(`negronicompress.Budget.Concurrent() = %d, want %d`, n, 1)
+	}
+	b.done()
+	if !b.acquire() {
+		t.Error(`negronicompress.Budget.acquire() = false, want true`)
+	}
+
+	b = NewBudget(0, 0)
+	if !b.reserve(1<<40) || !b.acquire() || !b.acquire() {
+		t.Error(`negronicompress.NewBudget(0, 0) should not limit anything`)
+	}
+}
+
+func TestCompress_SetBudget(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		maxBytes int64
+		busy     bool
+		skipped  SkipReason
+	}{
+		{int64(len(cnt)) - 1, false, SkipBudget},
+		{int64(len(cnt)) + 1, false, SkipBudget},
+		{0, true, SkipConcurrency},
+		{int64(len(cnt)) * 2, false, ``},
+	} {
+		b := NewBudget(e.maxBytes, 1)
+		if e.busy {
+			b.acquire()
+		}
+		handler.SetBudget(b)
+
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Write([]byte(cnt[:10]))
+			w.Write([]byte(cnt[10:]))
+		})
+		if res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.Result.Skipped with budget of %d bytes = %q, want %q`, e.maxBytes, res.Skipped, e.skipped)
+		}
+		if e.skipped != `` && w.Body.String() != cnt {
+			t.Errorf(`httptest.NewRecorder().Body.String() = %q, want %q`, w.Body.String(), cnt)
+		}
+		if n := b.Bytes(); n != 0 {
+			t.Errorf(`negronicompress.Budget.Bytes() after request = %d, want %d`, n, 0)
+		}
+		if e.busy {
+			b.done()
+		}
+		if n := b.Concurrent(); n != 0 {
+			t.Errorf(`negronicompress.Budget.Concurrent() after request = %d, want %d`, n, 0)
+		}
+	}
+
+	m := handler.Metrics()
+	if n := counter(&m.skipped, SkipBudget).Load(); n != 2 {
+		t.Errorf(`negronicompress.Metrics.skipped[%q] = %d, want %d`, SkipBudget, n, 2)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// transport is a RoundTripper that decodes responses and compresses request
+// bodies with registered content codings.
+type transport struct {
+	rt http.RoundTripper
+	// encoding is the content coding request bodies are compressed with.
+	// Empty disables compression of requests.
+	encoding string
+	// level is the compression level of request bodies.
+	level int
+	// minSize is the minimum size of request bodies that are compressed.
+	minSize int64
+}
+
+// NewTransport returns a RoundTripper that sends requests with rt, or
+// http.DefaultTransport if rt is nil. Unless a request already carries its own
+// "Accept-Encoding" header, all registered encodings that can be decoded are
+// advertised in it and responses encoded with any of them are decoded before
+// they are returned, just like http.Transport does for gzip alone.
+func NewTransport(rt http.RoundTripper) *transport {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &transport{rt: rt}
+}
+
+// SetRequestCompression makes the transport compress request bodies of at
+// least minSize bytes with encoding at the given compression level. Only use
+// it with servers known to accept such requests. Requests that already have a
+// "Content-Encoding" header are sent as is. Empty encoding disables
+// compression of requests.
+func (t *transport) SetRequestCompression(encoding string, level int, minSize int64) {
+	t.encoding, t.level, t.minSize = strings.ToLower(encoding), level, minSize
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Requests must not be modified by a RoundTripper.
+	r = r.Clone(r.Context())
+
+	decode := r.Header.Get(headerAcceptEncoding) == ``
+	if decode {
+		r.Header.Set(headerAcceptEncoding, strings.Join(decodableEncodings(), `, `))
+	}
+	if t.encoding != `` && r.Body != nil && r.Body != http.NoBody && r.Header.Get(headerContentEncoding) == `` {
+		if err := t.compressRequest(r); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.rt.RoundTrip(r)
+	if err != nil || !decode {
+		return resp, err
+	}
+
+	encoding := resp.Header.Get(headerContentEncoding)
+	if encoding == `` || r.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	// Content of codings that cannot be decoded is passed on untouched.
+	if c, ok := lookupCoding(encoding); !ok || c.decoder == nil {
+		return resp, nil
+	}
+
+	resp.Body = &decodedBody{body: resp.Body, encoding: encoding}
+	resp.Header.Del(headerContentEncoding)
+	resp.Header.Del(headerContentLength)
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// compressRequest replaces the body of r with its compressed form if it is at
+// least minSize bytes long.
+func (t *transport) compressRequest(r *http.Request) error {
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if int64(len(b)) >= t.minSize {
+		var buf bytes.Buffer
+		if err = encode(&buf, t.encoding, t.level, b); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+		r.Header.Set(headerContentEncoding, t.encoding)
+	}
+
+	r.ContentLength = int64(len(b))
+	r.Header.Del(headerContentLength)
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return nil
+}
+
+// decodedBody is a response body decoded on first read, so that empty bodies
+// of responses with a "Content-Encoding" header can still be read and closed.
+type decodedBody struct {
+	body     io.ReadCloser
+	encoding string
+	dec      io.ReadCloser
+	err      error
+}
+
+// Read implements io.Reader.
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.dec == nil && b.err == nil {
+		b.dec, b.err = NewDecoder(b.body, b.encoding)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	return b.dec.Read(p)
+}
+
+// Close implements io.Closer.
+func (b *decodedBody) Close() error {
+	if b.dec != nil {
+		b.dec.Close()
+	}
+
+	return b.body.Close()
+}
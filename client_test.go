@@ -0,0 +1,120 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	cnt := strings.Repeat(`client `, 1000)
+	var gz bytes.Buffer
+	encode(&gz, headerGzip, flate.DefaultCompression, []byte(cnt))
+
+	var accept, requestEncoding string
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept, requestEncoding = r.Header.Get(headerAcceptEncoding), r.Header.Get(headerContentEncoding)
+		body := io.Reader(r.Body)
+		if requestEncoding != `` {
+			dec, err := NewDecoder(r.Body, requestEncoding)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = dec
+		}
+		requestBody, _ = io.ReadAll(body)
+
+		w.Header().Set(headerContentEncoding, headerGzip)
+		w.Header().Set(headerContentLength, strconv.Itoa(gz.Len()))
+		if r.Method != http.MethodHead {
+			w.Write(gz.Bytes())
+		}
+	}))
+	defer server.Close()
+
+	tr := NewTransport(nil)
+	client := &http.Client{Transport: tr}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf(`http.Client.Get() = %v, want nil`, err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if accept != `gzip, deflate` {
+		t.Errorf(`%s sent by negronicompress.transport = %q, want %q`, headerAcceptEncoding, accept, `gzip, deflate`)
+	}
+	if err != nil || string(b) != cnt || !resp.Uncompressed || resp.Header.Get(headerContentEncoding) != `` {
+		t.Errorf(`negronicompress.transport response = %d bytes, %v, uncompressed %t; want %d decoded bytes, nil, true`, len(b), err, resp.Uncompressed, len(cnt))
+	}
+
+	// Responses to requests with their own encodings are left alone.
+	req, _ := http.NewRequest(`GET`, server.URL, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	resp, _ = client.Do(req)
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(b, gz.Bytes()) || resp.Header.Get(headerContentEncoding) != headerGzip {
+		t.Errorf(`negronicompress.transport response to request with %s = %d bytes, want %d encoded bytes`, headerAcceptEncoding, len(b), gz.Len())
+	}
+
+	// Bodies of HEAD responses are not decoded.
+	resp, _ = client.Head(server.URL)
+	if b, err = io.ReadAll(resp.Body); err != nil || len(b) != 0 {
+		t.Errorf(`negronicompress.transport HEAD response = %d bytes, %v; want 0 bytes, nil`, len(b), err)
+	}
+	resp.Body.Close()
+
+	tr.SetRequestCompression(headerDeflate, flate.BestSpeed, 100)
+	for _, e := range []struct {
+		body, encoding string
+	}{
+		{strings.Repeat(`.`, 99), ``},
+		{strings.Repeat(`.`, 100), headerDeflate},
+	} {
+		resp, err = client.Post(server.URL, `text/plain`, strings.NewReader(e.body))
+		if err != nil {
+			t.Fatalf(`http.Client.Post() = %v, want nil`, err)
+		}
+		resp.Body.Close()
+		if requestEncoding != e.encoding || string(requestBody) != e.body {
+			t.Errorf(`negronicompress.transport request of %d bytes = %q, %d bytes; want %q, %d bytes`, len(e.body), requestEncoding, len(requestBody), e.encoding, len(e.body))
+		}
+	}
+}
+
+func TestTransport_EncodeOnly(t *testing.T) {
+	defer func(c []coding, s []string) {
+		codings, supportedEncodings = c, s
+	}(codings, supportedEncodings)
+	RegisterEncoding(`x-encode-only`, func(w io.Writer, level int) (Encoder, error) {
+		return plainEncoder{w}, nil
+	}, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentEncoding, `x-encode-only`)
+		w.Write([]byte(`encoded`))
+	}))
+	defer server.Close()
+
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Get(server.URL)
+	if err != nil {
+		t.Fatalf(`http.Client.Get() = %v, want nil`, err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(b) != `encoded` || resp.Uncompressed || resp.Header.Get(headerContentEncoding) != `x-encode-only` {
+		t.Errorf(`negronicompress.transport response of encode only coding = %q, %v, uncompressed %t; want %q, nil, false`, b, err, resp.Uncompressed, `encoded`)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// payload is a single response of the corpus.
+type payload struct {
+	name        string
+	contentType string
+	content     []byte
+}
+
+// har is the part of an HTTP Archive file holding response content.
+type har struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// loadCorpus reads payloads from path, which is either a directory read
+// recursively or an HTTP Archive file with a ".har" extension.
+func loadCorpus(path string) ([]payload, error) {
+	if strings.EqualFold(filepath.Ext(path), `.har`) {
+		return loadHAR(path)
+	}
+
+	return loadDir(path)
+}
+
+// loadDir reads every regular file below dir as a payload. The content type is
+// derived from the file extension or, failing that, from the content itself.
+func loadDir(dir string) ([]payload, error) {
+	var corpus []payload
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == `` {
+			contentType = http.DetectContentType(b)
+		}
+		corpus = append(corpus, payload{path, contentType, b})
+
+		return nil
+	})
+
+	return corpus, err
+}
+
+// loadHAR reads every response with content in the HTTP Archive file at path
+// as a payload.
+func loadHAR(path string) ([]payload, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var h har
+	if err = json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+
+	var corpus []payload
+	for _, e := range h.Log.Entries {
+		c := e.Response.Content
+		content := []byte(c.Text)
+		if c.Encoding == `base64` {
+			if content, err = base64.StdEncoding.DecodeString(c.Text); err != nil {
+				return nil, err
+			}
+		}
+		if len(content) == 0 {
+			continue
+		}
+		corpus = append(corpus, payload{e.Request.URL, c.MimeType, content})
+	}
+
+	return corpus, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCorpus(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, `css`), 0o755)
+	os.WriteFile(filepath.Join(dir, `index.html`), []byte(`<html></html>`), 0o644)
+	os.WriteFile(filepath.Join(dir, `css`, `site.css`), []byte(`body{}`), 0o644)
+	os.WriteFile(filepath.Join(dir, `README`), []byte(`plain text`), 0o644)
+
+	corpus, err := loadCorpus(dir)
+	if err != nil || len(corpus) != 3 {
+		t.Fatalf(`loadCorpus(%q) = %d payloads, %v; want 3, nil`, dir, len(corpus), err)
+	}
+	for _, p := range corpus {
+		if want := map[string]string{`README`: `text/plain`, `site.css`: `text/css`, `index.html`: `text/html`}[filepath.Base(p.name)]; !strings.HasPrefix(p.contentType, want) {
+			t.Errorf(`loadCorpus(%q) content type of %s = %q, want %q`, dir, p.name, p.contentType, want)
+		}
+	}
+
+	har := filepath.Join(dir, `site.HAR`)
+	os.WriteFile(har, []byte(`{"log":{"entries":[
+		{"request":{"url":"http://localhost/"},"response":{"content":{"mimeType":"text/html","text":"<html></html>"}}},
+		{"request":{"url":"http://localhost/logo.png"},"response":{"content":{"mimeType":"image/png","text":"iVBORw0KGgo=","encoding":"base64"}}},
+		{"request":{"url":"http://localhost/empty"},"response":{"content":{"mimeType":"text/plain"}}}
+	]}}`), 0o644)
+	corpus, err = loadCorpus(har)
+	if err != nil || len(corpus) != 2 {
+		t.Fatalf(`loadCorpus(%q) = %d payloads, %v; want 2, nil`, har, len(corpus), err)
+	}
+	if p := corpus[1]; p.name != `http://localhost/logo.png` || p.contentType != `image/png` || string(p.content) != "\x89PNG\r\n\x1a\n" {
+		t.Errorf(`loadCorpus(%q)[1] = %q, %q, %q; want %q, %q, %q`, har, p.name, p.contentType, p.content, `http://localhost/logo.png`, `image/png`, "\x89PNG\r\n\x1a\n")
+	}
+
+	if _, err = loadCorpus(filepath.Join(dir, `missing`)); err == nil {
+		t.Errorf(`loadCorpus(%q) = _, nil; want err`, filepath.Join(dir, `missing`))
+	}
+}
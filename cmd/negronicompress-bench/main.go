@@ -0,0 +1,162 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command negronicompress-bench measures the compress middleware on a corpus of
+real responses, to help picking encodings and levels from data rather than
+guesses.
+
+The corpus is either a directory, whose files are all read recursively, or an
+HTTP Archive file exported from a browser, whose responses are used.
+
+	negronicompress-bench -levels 1,6,9 ./public
+	negronicompress-bench -encodings gzip -all site.har
+
+For every encoding and level, the whole corpus is served through the middleware
+and the ratio of sent to original bytes, the throughput and the allocations per
+response are reported. Only content types compressed by default are compressed,
+unless all of them are asked for.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+// responseWriter is a http.ResponseWriter counting the bytes written to it.
+type responseWriter struct {
+	header http.Header
+	n      int64
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(int) {}
+
+// result holds measurements of a single encoding and level.
+type result struct {
+	encoding   string
+	level      string
+	compressed int
+	in, out    int64
+	bench      testing.BenchmarkResult
+}
+
+func main() {
+	var (
+		encodings = flag.String(`encodings`, strings.Join(append([]string{`identity`}, negronicompress.Encodings()...), `,`), `comma separated list of encodings to measure`)
+		levels    = flag.String(`levels`, `1,6,9`, `comma separated list of compression levels to measure`)
+		all       = flag.Bool(`all`, false, `compress all content types`)
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <directory|file.har>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	corpus, err := loadCorpus(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(corpus) == 0 {
+		fmt.Fprintln(os.Stderr, `corpus is empty`)
+		os.Exit(1)
+	}
+
+	var l []int
+	for _, s := range strings.Split(*levels, `,`) {
+		level, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid level %q\n", s)
+			os.Exit(2)
+		}
+		l = append(l, level)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ENCODING\tLEVEL\tRESPONSES\tCOMPRESSED\tRATIO\tMB/s\tALLOCS/RESP\tBYTES/RESP\t")
+	for _, e := range strings.Split(*encodings, `,`) {
+		e = strings.TrimSpace(e)
+		el := l
+		if e == `identity` {
+			// Level does not matter for content sent as is.
+			el = l[:1]
+		}
+		for _, level := range el {
+			r := measure(corpus, e, level, *all)
+			if e == `identity` {
+				r.level = `-`
+			}
+			n := int64(len(corpus))
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.3f\t%.2f\t%d\t%d\t\n", r.encoding, r.level, n, r.compressed, float64(r.out)/float64(r.in), float64(r.in)/float64(r.bench.NsPerOp())*1e3, r.bench.AllocsPerOp()/n, r.bench.AllocedBytesPerOp()/n)
+		}
+	}
+	w.Flush()
+}
+
+// measure serves every payload of corpus through the middleware compressing at
+// level to a client accepting encoding.
+func measure(corpus []payload, encoding string, level int, all bool) result {
+	m := negronicompress.NewCompressWithCompressionLevel(level)
+	if all {
+		m.AddContentType(`*/*`)
+	}
+
+	handlers := make([]http.Handler, len(corpus))
+	for i, p := range corpus {
+		handlers[i] = m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(`Content-Type`, p.contentType)
+			w.Write(p.content)
+		}))
+	}
+	req := httptest.NewRequest(`GET`, `/`, nil)
+	req.Header.Set(`Accept-Encoding`, encoding)
+
+	r := result{encoding: encoding, level: strconv.Itoa(level)}
+	for i, h := range handlers {
+		w := &responseWriter{header: http.Header{}}
+		h.ServeHTTP(w, req)
+		if w.header.Get(`Content-Encoding`) != `` {
+			r.compressed++
+		}
+		r.in += int64(len(corpus[i].content))
+		r.out += w.n
+	}
+
+	r.bench = testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, h := range handlers {
+				h.ServeHTTP(&responseWriter{header: http.Header{}}, req)
+			}
+		}
+	})
+
+	return r
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+// sidecarExtensions holds the conventional file name extensions of encodings
+// that do not use their own name.
+var sidecarExtensions = map[string]string{`gzip`: `.gz`}
+
+// goTemplate is the template of the Go file embedding the output directory.
+var goTemplate = template.Must(template.New(`go`).Parse(`// Code generated by negronicompress-gen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+//go:embed all:{{.Dir}}
+var {{.Var}} embed.FS
+
+// {{.Var}}Handler returns a handler serving the precompressed assets embedded in
+// {{.Var}}.
+func {{.Var}}Handler() (http.Handler, error) {
+	fsys, err := fs.Sub({{.Var}}, {{printf "%q" .Dir}})
+	if err != nil {
+		return nil, err
+	}
+
+	return negronicompress.NewAssetHandler(fsys)
+}
+`))
+
+// generate writes every file of dir to out together with its variants in all
+// registered encodings worth compressing at level, and the index describing
+// them.
+func generate(dir, out string, level int, all bool) error {
+	m := negronicompress.NewCompressWithCompressionLevel(level)
+	if all {
+		m.AddContentType(`*/*`)
+	}
+	fsys := m.FS(os.DirFS(dir))
+
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	index := make(map[string]*negronicompress.Asset)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if abs, _ := filepath.Abs(path); abs == absOut {
+			// Output directory placed within the source one.
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == negronicompress.AssetIndex {
+			return nil
+		}
+
+		a := &negronicompress.Asset{Variants: make(map[string]negronicompress.AssetVariant)}
+		for _, encoding := range append([]string{`identity`}, negronicompress.Encodings()...) {
+			// File names are paths, not URLs, so they must not be parsed.
+			req := &http.Request{
+				Method: http.MethodGet,
+				URL:    &url.URL{Path: `/` + name},
+				Header: http.Header{`Accept-Encoding`: {encoding}},
+			}
+			w := httptest.NewRecorder()
+			fsys.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				return fmt.Errorf(`%s: %s`, path, http.StatusText(w.Code))
+			}
+
+			file := name
+			if encoding != `identity` {
+				if w.Header().Get(`Content-Encoding`) != encoding {
+					// Not worth compressing.
+					continue
+				}
+				file += sidecarExtension(encoding)
+				if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(file))); err == nil {
+					return fmt.Errorf(`%s: %s sidecar %s collides with a source file`, path, encoding, file)
+				}
+			} else {
+				a.ContentType = w.Header().Get(`Content-Type`)
+			}
+			if err := writeFile(filepath.Join(out, filepath.FromSlash(file)), w.Body.Bytes()); err != nil {
+				return err
+			}
+			sum := sha256.Sum256(w.Body.Bytes())
+			a.Variants[encoding] = negronicompress.AssetVariant{Path: file, Size: int64(w.Body.Len()), SHA256: hex.EncodeToString(sum[:])}
+		}
+		index[name] = a
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(index, ``, "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(out, negronicompress.AssetIndex), b)
+}
+
+// writeGo writes the Go file of package pkg embedding the output directory out
+// to path, with the embedded file system in variable name.
+func writeGo(path, out, pkg, name string) error {
+	dir, err := filepath.Rel(filepath.Dir(path), out)
+	if err != nil {
+		return err
+	}
+	dir = filepath.ToSlash(dir)
+	if dir == `.` || dir == `..` || strings.HasPrefix(dir, `../`) {
+		return fmt.Errorf(`output directory %s must be below the directory of %s`, out, path)
+	}
+
+	var b bytes.Buffer
+	if err = goTemplate.Execute(&b, struct{ Package, Dir, Var string }{pkg, dir, name}); err != nil {
+		return err
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, src, 0o644)
+}
+
+// sidecarExtension returns the file name extension of files encoded with
+// encoding.
+func sidecarExtension(encoding string) string {
+	if ext, ok := sidecarExtensions[encoding]; ok {
+		return ext
+	}
+
+	return `.` + encoding
+}
+
+// writeFile writes b to the file at path, creating its directory if needed.
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
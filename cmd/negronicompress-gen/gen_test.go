@@ -0,0 +1,123 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	html := strings.Repeat(`<p>precompressed</p>`, 500)
+	os.MkdirAll(filepath.Join(dir, `css`), 0o755)
+	os.WriteFile(filepath.Join(dir, `index.html`), []byte(html), 0o644)
+	os.WriteFile(filepath.Join(dir, `css`, `site.css`), []byte(`body{}`), 0o644)
+
+	out := filepath.Join(dir, `assets`)
+	if err := generate(dir, out, 9, false); err != nil {
+		t.Fatalf(`generate(%q, %q) = %v, want nil`, dir, out, err)
+	}
+	for _, name := range []string{`index.html`, `index.html.gz`, `index.html.deflate`, `css/site.css`, negronicompress.AssetIndex} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf(`generate(%q, %q) did not write %s: %v`, dir, out, name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, `css`, `site.css.gz`)); err == nil {
+		t.Errorf(`generate(%q, %q) compressed a file below the minimum size`, dir, out)
+	}
+
+	// Running again must not pick up its own output.
+	if err := generate(dir, out, 9, false); err != nil {
+		t.Fatalf(`generate(%q, %q) = %v, want nil`, dir, out, err)
+	}
+	h, err := negronicompress.NewAssetHandler(os.DirFS(out))
+	if err != nil {
+		t.Fatalf(`negronicompress.NewAssetHandler() = _, %v; want _, nil`, err)
+	}
+	for _, e := range []struct {
+		path, accept, encoding, body string
+	}{
+		{`/`, `gzip`, `gzip`, html},
+		{`/index.html`, `deflate, gzip;q=0.5`, `deflate`, html},
+		{`/index.html`, ``, ``, html},
+		{`/css/site.css`, `gzip`, ``, `body{}`},
+	} {
+		req := httptest.NewRequest(`GET`, e.path, nil)
+		req.Header.Set(`Accept-Encoding`, e.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		ce := w.Header().Get(`Content-Encoding`)
+		if w.Code != http.StatusOK || ce != e.encoding {
+			t.Errorf(`assets handler for %s with %q = %d, %q; want %d, %q`, e.path, e.accept, w.Code, ce, http.StatusOK, e.encoding)
+			continue
+		}
+		var body io.Reader = w.Body
+		if ce != `` {
+			body, _ = negronicompress.NewDecoder(w.Body, ce)
+		}
+		if b, _ := io.ReadAll(body); string(b) != e.body {
+			t.Errorf(`assets handler for %s with %q decoded to %d bytes, want %d`, e.path, e.accept, len(b), len(e.body))
+		}
+	}
+}
+
+func TestGenerate_Names(t *testing.T) {
+	dir := t.TempDir()
+	html := strings.Repeat(`<p>precompressed</p>`, 500)
+	names := []string{`my file.html`, `a%20b.html`, `what?.html`, `#hash.html`}
+	for _, name := range names {
+		os.WriteFile(filepath.Join(dir, name), []byte(html), 0o644)
+	}
+
+	out := filepath.Join(dir, `assets`)
+	if err := generate(dir, out, 9, false); err != nil {
+		t.Fatalf(`generate(%q, %q) = %v, want nil`, dir, out, err)
+	}
+	for _, name := range names {
+		for _, file := range []string{name, name + `.gz`} {
+			if b, err := os.ReadFile(filepath.Join(out, file)); err != nil || len(b) == 0 {
+				t.Errorf(`generate(%q, %q) wrote %s = %d bytes, %v; want content`, dir, out, file, len(b), err)
+			}
+		}
+	}
+}
+
+func TestGenerate_Collision(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, `app.html`), []byte(strings.Repeat(`<p>precompressed</p>`, 500)), 0o644)
+	os.WriteFile(filepath.Join(dir, `app.html.gz`), []byte(`not the sidecar`), 0o644)
+
+	out := filepath.Join(t.TempDir(), `assets`)
+	if err := generate(dir, out, 9, false); err == nil || !strings.Contains(err.Error(), `app.html.gz`) {
+		t.Errorf(`generate(%q, %q) with a source file named like a sidecar = %v, want collision error`, dir, out, err)
+	}
+}
+
+func TestWriteGo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `assets.go`)
+	if err := writeGo(path, filepath.Join(dir, `assets`), `web`, `ui`); err != nil {
+		t.Fatalf(`writeGo() = %v, want nil`, err)
+	}
+	b, _ := os.ReadFile(path)
+	for _, s := range []string{"package web\n", "//go:embed all:assets\nvar ui embed.FS\n", `fs.Sub(ui, "assets")`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf(`writeGo() wrote %q, want it to contain %q`, b, s)
+		}
+	}
+
+	if err := writeGo(path, dir, `web`, `ui`); err == nil {
+		t.Errorf(`writeGo() with output directory of the Go file = nil, want error`)
+	}
+}
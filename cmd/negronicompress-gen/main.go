@@ -0,0 +1,67 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Command negronicompress-gen precompresses static assets ahead of time, so that
+they can be embedded into a binary and served without any compression at run
+time or at startup.
+
+Every file of the source directory is copied to the output directory together
+with a sidecar file for every registered encoding, such as "app.js.gz", and an
+index describing their content types, sizes and hashes. Files are compressed by
+the same rules as in the compress middleware, so small files or files of other
+content types are only copied.
+
+	negronicompress-gen -o assets ./public
+
+When a Go file is given, it is written with an embedded file system holding the
+output directory and a function returning a handler serving it. This is most
+conveniently done with go:generate.
+
+	//go:generate go run github.com/mocheryl/negroni-compress/cmd/negronicompress-gen -o assets -go assets.go ./public
+
+The assets are served by negronicompress.NewAssetHandler, picking the variant
+the client prefers.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	var (
+		out    = flag.String(`o`, `assets`, `output directory`)
+		level  = flag.Int(`level`, 9, `compression level`)
+		all    = flag.Bool(`all`, false, `compress all content types`)
+		goFile = flag.String(`go`, ``, `Go file to write with the embedded output directory`)
+		pkg    = flag.String(`pkg`, os.Getenv(`GOPACKAGE`), `package name of the Go file`)
+		name   = flag.String(`var`, `assets`, `name of the embedded file system variable in the Go file`)
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <directory>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := generate(flag.Arg(0), *out, *level, *all); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *goFile != `` {
+		if *pkg == `` {
+			*pkg = `main`
+		}
+		if err := writeGo(*goFile, *out, *pkg, *name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
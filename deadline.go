@@ -0,0 +1,52 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// compressChunkSize is the size of chunks of content fed to the compressor
+// between checks for cancellation.
+const compressChunkSize int = 64 * 1024
+
+// SetMaxCompressionTime limits the time spent compressing a single response to
+// d. Compression that takes longer is aborted and the original content is sent
+// instead. Zero removes the limit.
+//
+// Regardless of this setting, compression is aborted and nothing is sent once
+// the request context is done, for example because the client disconnected.
+func (h *compress) SetMaxCompressionTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	h.maxCompressionTime = d
+}
+
+// copyContext copies src to dst in chunks of compressChunkSize bytes. It stops
+// with the error of ctx before copying the next chunk once ctx is done.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) error {
+	buf := make([]byte, compressChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
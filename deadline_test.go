@@ -0,0 +1,85 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyContext(t *testing.T) {
+	src := strings.Repeat(`.`, 3*compressChunkSize)
+	var b bytes.Buffer
+	if err := copyContext(context.Background(), &b, strings.NewReader(src)); err != nil || b.String() != src {
+		t.Errorf(`negronicompress.copyContext() = %d bytes, %v; want %d bytes, nil`, b.Len(), err, len(src))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := copyContext(ctx, io.Discard, strings.NewReader(src)); err != context.Canceled {
+		t.Errorf(`negronicompress.copyContext() with canceled context = %v, want %v`, err, context.Canceled)
+	}
+	if err := compressParallel(ctx, io.Discard, headerGzip, 1, strings.NewReader(src), int64(len(src)), compressChunkSize, 2); err != context.Canceled {
+		t.Errorf(`negronicompress.compressParallel() with canceled context = %v, want %v`, err, context.Canceled)
+	}
+}
+
+func TestCompress_Canceled(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, `GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	rctx, res := NewResultContext(req.Context())
+	req = req.WithContext(rctx)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+		cancel()
+	})
+
+	if res.Skipped != SkipCanceled {
+		t.Errorf(`negronicompress.compress.ServeHTTP() with canceled request skipped = %q, want %q`, res.Skipped, SkipCanceled)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf(`negronicompress.compress.ServeHTTP() with canceled request wrote %d bytes, want 0`, w.Body.Len())
+	}
+}
+
+func TestCompress_SetMaxCompressionTime(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+	handler.SetMaxCompressionTime(time.Nanosecond)
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	rctx, res := NewResultContext(req.Context())
+	req = req.WithContext(rctx)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+
+	if res.Skipped != SkipTimeout {
+		t.Errorf(`negronicompress.compress.ServeHTTP() with expired deadline skipped = %q, want %q`, res.Skipped, SkipTimeout)
+	}
+	if w.Header().Get(headerContentEncoding) != `` || w.Body.String() != cnt {
+		t.Errorf(`negronicompress.compress.ServeHTTP() with expired deadline did not send original content`)
+	}
+
+	handler.SetMaxCompressionTime(-time.Second)
+	if handler.maxCompressionTime != 0 {
+		t.Errorf(`negronicompress.compress.SetMaxCompressionTime(-1s) = %v, want 0`, handler.maxCompressionTime)
+	}
+}
@@ -6,7 +6,7 @@
 Package negronicompress implements a Negroni middleware handler for various
 HTTP content compression methods.
 
-Basics
+# Basics
 
 A lot of content that gets sent out form the HTTP server is usually in text
 format. This kind of output content can be large in size and has very good
@@ -20,7 +20,7 @@ agents supported compression formats. By doing this, any content sent back to
 client is greatly reduced in size and thus saving on bandwidth and
 consequentially loading time.
 
-Usage
+# Usage
 
 	package main
 
@@ -40,7 +40,7 @@ Usage
 			for i := 0; i <= 2048; i++ {
 				s += `.`
 			}
-			fmt.Fprintf(w, s)
+			fmt.Fprint(w, s)
 		})
 
 		n := negroni.Classic()
@@ -54,6 +54,14 @@ compressing only content types that are the most widely used in rendering a web
 page at a level that is a good compromise between speed of
 compression/decompression and compression ratio.
 
+The middleware can be used without Negroni as well, with net/http or any router
+accepting standard middleware.
+
+	m := NewCompress()
+	http.ListenAndServe(`:3000`, m.Handler(mux))
+
+	r.Use(NewMiddleware(flate.DefaultCompression))
+
 You can define your own level of compression by initializing the middleware like
 this:
 
@@ -63,6 +71,63 @@ Where higher value means better compression but also more processing time and
 power while lower number outputs encoded content faster but yields worse
 compression ratio. Keep in mind that the value cannot go below 1 nor above 9.
 
+Different levels can be used for different content types and encodings, for
+example to spend more time on cacheable assets than on dynamic content.
+
+	m.SetLevel(9, ``, `text/css`, `application/javascript`)
+	m.SetLevel(1, ``, `application/json`)
+
+Handlers can also ask for a faster or better compression of their own
+response.
+
+	SetRequestLevel(r, LevelFast)
+
+Clients on slow or metered connections announce themselves with the
+"Save-Data", "ECT" and "Downlink" headers. When enabled, responses to such
+clients are compressed at a chosen level and from a smaller size on.
+
+	m.SetClientHints(true, LevelBest, 512)
+
+Instead of fixed levels, the level can be capped by a controller that lowers
+it when too many compressions are in flight or when they take too long, and
+raises it again once the load drops.
+
+	a := NewAdaptiveLevel(flate.HuffmanOnly, flate.BestCompression)
+	a.SetTargets(runtime.NumCPU(), 5*time.Millisecond)
+	m.SetAdaptiveLevel(a)
+
+Since response content is buffered in memory before it is compressed, a burst
+of large responses can use a lot of memory. A budget shared by all middleware
+instances limits the number of buffered bytes and concurrent compressions.
+Responses exceeding it are sent uncompressed.
+
+	b := NewBudget(256<<20, runtime.NumCPU())
+	m.SetBudget(b)
+
+Very large responses, such as exports, can instead be moved to temporary files
+once they grow over a threshold. Their exact "Content-Length" is still sent
+and the files are removed as soon as the response is done.
+
+	m.SetSpill(64<<20, ``)
+
+Compression of such large responses can also be spread over several CPU
+cores. Content above the threshold is split into blocks that are compressed
+in parallel and joined into a single valid "gzip" or "deflate" stream.
+
+	m.SetParallel(8<<20, 0, 0)
+
+Compression stops as soon as the client goes away and nothing is sent. The time
+spent compressing a single response can be limited as well, in which case the
+original content is sent once the limit is reached.
+
+	m.SetMaxCompressionTime(50 * time.Millisecond)
+
+Handlers streaming their responses, such as server-sent events, flush them to
+get the data to the client right away. From the first flush on, such responses
+are compressed on the fly and every flush also flushes the compressor.
+Responses that must not be transformed according to "Cache-Control" and
+partial content are never compressed.
+
 You can specify additional content types to check for compression.
 
 	m.AddContentType(`application/pdf`, `image/*`)
@@ -71,7 +136,101 @@ This will compress all .pdf files and images when the middeleware comes across
 them in the "Content-Type" HTTP header usually set by the other backend
 services.
 
-Tips
+Apart from "*", which matches any sequence of characters, content types are
+matched literally, so "application/*+json" matches "application/vnd.api+json".
+
+Content that is already in a compressed format, such as ZIP archives, PNG
+images or gzip files, is recognized by its leading bytes and sent as is. More
+formats can be recognized by adding their signatures.
+
+	m.AddSignature(Signature{Name: `rar`, Magic: []byte("Rar!\x1a\x07")})
+
+For content of unknown formats, a cheap entropy estimate can be used to skip
+content that looks random.
+
+	m.SetEntropyThreshold(7.5)
+
+Compressed content is only sent when it is actually smaller than the original.
+A minimum required saving can be set, optionally checked on an initial window
+of the content so that poorly compressible content is given up on early.
+
+	m.SetMinSavings(0.1, 64*1024)
+
+Content that is already encoded, for example by a proxied server, is never
+compressed again. If the client does not accept its encoding, it can instead be
+decoded and compressed with an encoding the client does accept, or sent as is.
+Only content that decodes to at most the given size is transcoded.
+
+	m.SetTranscode(8 << 20)
+
+When the middleware sits in front of an httputil.ReverseProxy, use the proxy
+transport so that the upstream server is asked for the encodings the client
+accepts. Its encoded responses are then streamed through untouched and only
+identity responses are compressed.
+
+	p := httputil.NewSingleHostReverseProxy(target)
+	p.Transport = NewProxyTransport(nil)
+
+Assets packaged as a ZIP archive can be served straight from it. Deflated
+entries are already valid "deflate" content and are sent as "gzip" or
+"deflate" without being compressed again. Only clients accepting neither get
+them decompressed.
+
+	f, _ := os.Open(`assets.zip`)
+	fi, _ := f.Stat()
+	h, _ := NewZipHandler(f, fi.Size())
+	mux.Handle(`/assets/`, http.StripPrefix(`/assets`, h))
+
+Files that never change, such as a web UI embedded with embed.FS, do not need
+to be compressed on every request. The file system returned by the FS method
+compresses each file once per encoding, following the rules of the middleware,
+and keeps the result. Every encoding is sent with its own strong "ETag".
+
+	//go:embed ui
+	var ui embed.FS
+
+	fsys := m.FS(ui)
+	fsys.Precompress() // Optional, otherwise files are compressed on demand.
+	mux.Handle(`/ui/`, fsys)
+
+Assets can also be compressed ahead of time with the negronicompress-gen
+command, which writes every file together with its variants in all registered
+encodings and an index to a directory ready to be embedded. They are then
+served without any compression cost, not even at startup.
+
+	//go:generate go run github.com/mocheryl/negroni-compress/cmd/negronicompress-gen -o assets -go assets.go ./public
+
+	h, _ := assetsHandler() // Declared in the generated assets.go.
+	mux.Handle(`/static/`, http.StripPrefix(`/static`, h))
+
+Files served from a ZIP archive, the FS method or precompressed assets support
+range requests over the compressed representation, so large downloads can be
+both compressed and resumed. "If-Range" is checked against the "ETag" of the
+encoding being sent. Responses compressed on the fly by the middleware cannot
+serve ranges, so their "Accept-Ranges" header is removed.
+
+Further content codings can be registered with an encoder, a decoder or both.
+Encodings with an encoder are offered to clients by the middleware, while the
+decoders are used for transcoding and by the client transport.
+
+	RegisterEncoding(`br`, newBrotliEncoder, newBrotliDecoder)
+
+The client transport advertises all registered encodings, decodes responses
+and can compress request bodies for servers known to accept them.
+
+	t := NewTransport(nil)
+	t.SetRequestCompression(`gzip`, flate.BestSpeed, 1024)
+	client := &http.Client{Transport: t}
+
+Package negronicompresstest provides helpers for testing handlers behind the
+middleware across all registered encodings, as well as a conformance suite that
+checks responses of any middleware configuration against HTTP semantics.
+
+	func TestMiddleware(t *testing.T) {
+		negronicompresstest.Conformance(t, m.Handler)
+	}
+
+# Tips
 
 If you have multiple instances of this middleware and all share the same custom
 list of content types allowed to compress, you can alter the global list with a
@@ -91,5 +250,53 @@ To clear the list, you can call the same function by specifying all types.
 Empty list means match any type and thus compress it. After the function call
 you can then freely create your own custom list of types.
 
+# Metrics
+
+Every middleware instance collects statistics about the responses it handles,
+such as the number of compressed and skipped responses, sizes before and after
+compression and time spent compressing. They can be exposed to Prometheus by
+mounting them as a regular handler.
+
+	m := NewCompress()
+	mux.Handle(`/metrics`, m.Metrics())
+
+# Observers
+
+To log or trace compression decisions, set an observer on the middleware. A
+ready-made one writing to a log/slog logger is available.
+
+	m.SetObserver(NewSlogObserver(slog.Default()))
+
+The outcome of each request is also stored in the request context. Middleware
+placed in front of this one can prepare the context and read the result after
+the rest of the chain has returned.
+
+	ctx, res := NewResultContext(r.Context())
+	next(rw, r.WithContext(ctx))
+	log.Printf(`%s %s %.2f`, r.URL.Path, res.Encoding, res.Ratio())
+
+# Debugging
+
+To find out why a particular response was or was not compressed, enable debug
+headers for requests carrying a chosen header.
+
+	m.SetExplainHeader(`X-Compression-Debug`)
+
+Such responses will then include headers like
+"X-Compression-Decision: skipped; reason=min-size".
+
+# Tuning
+
+Before changing the compression level in production, its effect can be measured
+on real traffic with shadow mode. Responses are then sent unchanged while a
+sample of them is compressed in the background and only recorded in metrics.
+
+	m.SetShadow(0.1, flate.BestCompression)
+
+Levels and encodings can also be compared offline on a corpus of responses,
+either a directory of files or a HAR file exported from a browser, with the
+negronicompress-bench command.
+
+	go run github.com/mocheryl/negroni-compress/cmd/negronicompress-bench -levels 1,6,9 site.har
 */
 package negronicompress
@@ -0,0 +1,164 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Encoder is a writer of content encoded with a content coding. Flush writes
+// any pending data to the underlying writer, so that the content written so far
+// can be decoded.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// EncoderFunc returns an Encoder writing content encoded at the given
+// compression level to w.
+type EncoderFunc func(w io.Writer, level int) (Encoder, error)
+
+// DecoderFunc returns a reader of content read from r and decoded.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+// coding is a registered content coding.
+type coding struct {
+	name    string
+	encoder EncoderFunc
+	decoder DecoderFunc
+}
+
+// codings is a list of registered content codings in the order of preference.
+var codings = []coding{
+	{headerGzip, newGzipEncoder, newGzipDecoder},
+	{headerDeflate, newDeflateEncoder, newDeflateDecoder},
+}
+
+// supportedEncodings is a list of content encodings the middleware can produce
+// in the order of preference used when the client accepts any encoding.
+var supportedEncodings = []string{headerGzip, headerDeflate}
+
+// RegisterEncoding registers a content coding under name, or replaces the one
+// already registered under it. An encoding with an encoder is offered to
+// clients by all middleware instances and is preferred after the previously
+// registered ones when the client accepts several encodings equally. An
+// encoding without an encoder is only used to decode content, for example when
+// transcoding or in responses received by a client transport.
+//
+// RegisterEncoding is meant to be called during program initialization and is
+// not safe for concurrent use with the middleware.
+func RegisterEncoding(name string, encoder EncoderFunc, decoder DecoderFunc) {
+	name = strings.ToLower(name)
+	c := coding{name, encoder, decoder}
+
+	registered := false
+	list := make([]coding, 0, len(codings)+1)
+	for _, e := range codings {
+		if e.name == name {
+			e, registered = c, true
+		}
+		list = append(list, e)
+	}
+	if !registered {
+		list = append(list, c)
+	}
+
+	names := make([]string, 0, len(list))
+	for _, e := range list {
+		if e.encoder != nil {
+			names = append(names, e.name)
+		}
+	}
+
+	codings, supportedEncodings = list, names
+}
+
+// lookupCoding returns the coding registered under encoding. "x-gzip" is an
+// alias of "gzip".
+func lookupCoding(encoding string) (coding, bool) {
+	encoding = strings.ToLower(encoding)
+	if encoding == `x-gzip` {
+		encoding = headerGzip
+	}
+	for _, c := range codings {
+		if c.name == encoding {
+			return c, true
+		}
+	}
+
+	return coding{}, false
+}
+
+// Encodings returns a list of registered encodings the middleware can produce
+// in the order of preference.
+func Encodings() []string {
+	return append([]string(nil), supportedEncodings...)
+}
+
+// decodableEncodings returns a list of registered encodings that can be
+// decoded.
+func decodableEncodings() []string {
+	names := make([]string, 0, len(codings))
+	for _, c := range codings {
+		if c.decoder != nil {
+			names = append(names, c.name)
+		}
+	}
+
+	return names
+}
+
+// newEncoder returns a writer encoding data written to it with encoding at the
+// given compression level into w.
+func newEncoder(w io.Writer, encoding string, level int) (Encoder, error) {
+	if c, ok := lookupCoding(encoding); ok && c.encoder != nil {
+		return c.encoder(w, level)
+	}
+
+	return nil, fmt.Errorf(`negronicompress: unsupported encoding %q`, encoding)
+}
+
+// NewDecoder returns a reader of content read from r decoded from encoding,
+// which can be any registered encoding.
+func NewDecoder(r io.Reader, encoding string) (io.ReadCloser, error) {
+	if c, ok := lookupCoding(encoding); ok && c.decoder != nil {
+		return c.decoder(r)
+	}
+
+	return nil, fmt.Errorf(`negronicompress: unsupported encoding %q`, encoding)
+}
+
+// newGzipEncoder returns an encoder of the "gzip" content coding.
+func newGzipEncoder(w io.Writer, level int) (Encoder, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+// newGzipDecoder returns a decoder of the "gzip" content coding.
+func newGzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateEncoder returns an encoder of the "deflate" content coding.
+func newDeflateEncoder(w io.Writer, level int) (Encoder, error) {
+	return flate.NewWriter(w, level)
+}
+
+// newDeflateDecoder returns a decoder of the "deflate" content coding. Content
+// is accepted both with and without the zlib wrapper, since servers disagree
+// on which one the name stands for.
+func newDeflateDecoder(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(2); err == nil && b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
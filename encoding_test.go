@@ -0,0 +1,97 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+)
+
+// plainEncoder is an encoder of a test content coding that leaves content as
+// is.
+type plainEncoder struct {
+	io.Writer
+}
+
+func (plainEncoder) Flush() error { return nil }
+
+func (plainEncoder) Close() error { return nil }
+
+func TestRegisterEncoding(t *testing.T) {
+	defer func(c []coding, s []string) {
+		codings, supportedEncodings = c, s
+	}(codings, supportedEncodings)
+
+	RegisterEncoding(`X-Plain`, func(w io.Writer, level int) (Encoder, error) {
+		return plainEncoder{w}, nil
+	}, func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	})
+	RegisterEncoding(`x-decode-only`, nil, func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	})
+
+	if e := negotiateEncoding(`x-plain`); e != `x-plain` {
+		t.Errorf(`negronicompress.negotiateEncoding("x-plain") = %q, want %q`, e, `x-plain`)
+	}
+	if e := negotiateEncoding(`x-decode-only`); e != `` {
+		t.Errorf(`negronicompress.negotiateEncoding("x-decode-only") = %q, want %q`, e, ``)
+	}
+	if e := strings.Join(decodableEncodings(), `, `); e != `gzip, deflate, x-plain, x-decode-only` {
+		t.Errorf(`negronicompress.decodableEncodings() = %q, want %q`, e, `gzip, deflate, x-plain, x-decode-only`)
+	}
+
+	var b bytes.Buffer
+	if err := encode(&b, `x-plain`, 0, []byte(`plain`)); err != nil || b.String() != `plain` {
+		t.Errorf(`negronicompress.encode("x-plain") = %q, %v; want %q, nil`, b.String(), err, `plain`)
+	}
+
+	// Registering an existing encoding replaces it in place.
+	RegisterEncoding(headerGzip, nil, newGzipDecoder)
+	if e := strings.Join(supportedEncodings, `, `); e != `deflate, x-plain` {
+		t.Errorf(`negronicompress.supportedEncodings = %q, want %q`, e, `deflate, x-plain`)
+	}
+	if _, err := newEncoder(io.Discard, headerGzip, flate.DefaultCompression); err == nil {
+		t.Error(`negronicompress.newEncoder("gzip") of decode only encoding = nil, want err`)
+	}
+}
+
+func TestNewDecoder(t *testing.T) {
+	cnt := strings.Repeat(`decode me `, 100)
+
+	var gz, fl, zl bytes.Buffer
+	encode(&gz, headerGzip, flate.DefaultCompression, []byte(cnt))
+	encode(&fl, headerDeflate, flate.DefaultCompression, []byte(cnt))
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(cnt))
+	zw.Close()
+
+	for _, e := range []struct {
+		encoding string
+		content  []byte
+	}{
+		{headerGzip, gz.Bytes()},
+		{`x-gzip`, gz.Bytes()},
+		{headerDeflate, fl.Bytes()},
+		{headerDeflate, zl.Bytes()},
+	} {
+		dec, err := NewDecoder(bytes.NewReader(e.content), e.encoding)
+		if err != nil {
+			t.Errorf(`negronicompress.NewDecoder(%q) = %v, want nil`, e.encoding, err)
+			continue
+		}
+		if b, err := io.ReadAll(dec); err != nil || string(b) != cnt {
+			t.Errorf(`negronicompress.NewDecoder(%q) decoded %d bytes, %v; want %d bytes, nil`, e.encoding, len(b), err, len(cnt))
+		}
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(nil), `br`); err == nil {
+		t.Error(`negronicompress.NewDecoder("br") = nil, want err`)
+	}
+}
@@ -9,3 +9,7 @@ import "errors"
 // ErrBadContentTypeFormat is returned when a file type in incorrect format is
 // used.
 var ErrBadContentTypeFormat = errors.New(`Syntax error in content type`)
+
+// errNoSavings is returned when compressed content would not be sufficiently
+// smaller than the original.
+var errNoSavings = errors.New(`Insufficient compression savings`)
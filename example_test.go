@@ -20,7 +20,7 @@ func ExampleNewCompress() {
 		for i := 0; i <= 2048; i++ {
 			s += `.`
 		}
-		fmt.Fprintf(w, s)
+		fmt.Fprint(w, s)
 	})
 
 	n := negroni.Classic()
@@ -0,0 +1,64 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	headerCompressionDecision string = `X-Compression-Decision`
+	headerCompressionRatio    string = `X-Compression-Ratio`
+	headerServerTiming        string = `Server-Timing`
+)
+
+// SetExplainHeader enables debug headers describing the compression decision
+// for requests that carry a non-empty header with the given name. Passing an
+// empty name disables them.
+func (h *compress) SetExplainHeader(name string) {
+	if name == `` {
+		h.explain = nil
+		return
+	}
+
+	h.explain = func(r *http.Request) bool {
+		return r.Header.Get(name) != ``
+	}
+}
+
+// SetExplainFunc enables debug headers describing the compression decision for
+// requests for which f returns true. Passing nil disables them.
+//
+// When enabled, the "X-Compression-Decision" header holds either the used
+// encoding or the reason the response was not compressed, for example
+// "skipped; reason=min-size". Compressed responses additionally carry the
+// "X-Compression-Ratio" header and a "Server-Timing" entry with the time spent
+// compressing, so the decision can be inspected from browser developer tools.
+// Responses compressed on the fly once the handler flushed them are marked with
+// a "streamed" parameter instead, since their ratio is not known when the
+// headers are sent.
+func (h *compress) SetExplainFunc(f func(r *http.Request) bool) {
+	h.explain = f
+}
+
+// explainResult adds debug headers describing res to header.
+func explainResult(header http.Header, res *Result) {
+	if res.Encoding == `` {
+		header.Set(headerCompressionDecision, `skipped; reason=`+string(res.Skipped))
+		return
+	}
+
+	header.Set(headerCompressionDecision, `compressed; encoding=`+res.Encoding)
+	header.Set(headerCompressionRatio, strconv.FormatFloat(res.Ratio(), 'f', 3, 64))
+	header.Add(headerServerTiming, `compress;dur=`+strconv.FormatFloat(float64(res.Duration.Microseconds())/1000, 'f', 3, 64)+`;desc="`+res.Encoding+`"`)
+}
+
+// explainStream adds debug headers to header of a response compressed on the
+// fly with encoding. Its ratio and compression time are not known yet when the
+// header is sent.
+func explainStream(header http.Header, encoding string) {
+	header.Set(headerCompressionDecision, `compressed; encoding=`+encoding+`; streamed`)
+}
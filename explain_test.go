@@ -0,0 +1,124 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainResult(t *testing.T) {
+	h := make(http.Header)
+	explainResult(h, &Result{Skipped: SkipMinSize})
+	if d := h.Get(headerCompressionDecision); d != `skipped; reason=min-size` {
+		t.Errorf(`negronicompress.explainResult() %s = %q, want %q`, headerCompressionDecision, d, `skipped; reason=min-size`)
+	}
+	if r := h.Get(headerCompressionRatio); r != `` {
+		t.Errorf(`negronicompress.explainResult() %s = %q, want %q`, headerCompressionRatio, r, ``)
+	}
+
+	h = make(http.Header)
+	h.Set(headerServerTiming, `db;dur=10`)
+	explainResult(h, &Result{Encoding: headerGzip, InSize: 1000, OutSize: 250, Duration: 1500 * time.Microsecond})
+	if d := h.Get(headerCompressionDecision); d != `compressed; encoding=gzip` {
+		t.Errorf(`negronicompress.explainResult() %s = %q, want %q`, headerCompressionDecision, d, `compressed; encoding=gzip`)
+	}
+	if r := h.Get(headerCompressionRatio); r != `0.250` {
+		t.Errorf(`negronicompress.explainResult() %s = %q, want %q`, headerCompressionRatio, r, `0.250`)
+	}
+	if s := h.Values(headerServerTiming); len(s) != 2 || s[1] != `compress;dur=1.500;desc="gzip"` {
+		t.Errorf(`negronicompress.explainResult() %s = %q, want %q`, headerServerTiming, s, []string{`db;dur=10`, `compress;dur=1.500;desc="gzip"`})
+	}
+}
+
+func TestCompress_SetExplainHeader(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+	handler.SetExplainHeader(`X-Debug`)
+
+	for _, e := range []struct {
+		debug, accept, contentType, decision string
+	}{
+		{``, headerGzip, `text/plain`, ``},
+		{`1`, ``, `text/plain`, `skipped; reason=not-accepted`},
+		{`1`, headerGzip, `image/png`, `skipped; reason=content-type`},
+		{`1`, headerGzip, `text/plain`, `compressed; encoding=gzip`},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		req.Header.Set(`X-Debug`, e.debug)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, e.contentType)
+			w.Write([]byte(cnt))
+		})
+		if d := w.Header().Get(headerCompressionDecision); d != e.decision {
+			t.Errorf(`negronicompress.compress.ServeHTTP() %s = %q, want %q`, headerCompressionDecision, d, e.decision)
+		}
+	}
+
+	handler.SetExplainHeader(``)
+	if handler.explain != nil {
+		t.Error(`negronicompress.compress.SetExplainHeader("") did not disable explain mode`)
+	}
+}
+
+func TestCompress_SetExplainFunc(t *testing.T) {
+	handler := NewCompress()
+	handler.SetExplainFunc(func(r *http.Request) bool {
+		return r.URL.Query().Get(`explain`) != ``
+	})
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo?explain=1`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(`.`))
+	})
+	if d := w.Header().Get(headerCompressionDecision); d != `skipped; reason=min-size` {
+		t.Errorf(`negronicompress.compress.ServeHTTP() %s = %q, want %q`, headerCompressionDecision, d, `skipped; reason=min-size`)
+	}
+}
+
+func TestCompress_SetExplainPassthrough(t *testing.T) {
+	cnt := strings.Repeat(`passed through `, 1000)
+	handler := NewCompress()
+	handler.SetExplainHeader(`X-Debug`)
+	handler.SetBudget(NewBudget(4096, 4))
+
+	for _, e := range []struct {
+		name, contentType, encoding string
+		flush                       bool
+		decision                    string
+	}{
+		{`budget`, `text/plain`, ``, false, `skipped; reason=budget`},
+		{`encoded`, `text/plain`, headerGzip, false, `skipped; reason=already-encoded`},
+		{`flush`, `text/plain`, ``, true, `compressed; encoding=gzip; streamed`},
+		{`flush skipped`, `image/png`, ``, true, `skipped; reason=content-type`},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		req.Header.Set(`X-Debug`, `1`)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, e.contentType)
+			w.Header().Set(headerContentEncoding, e.encoding)
+			if e.flush {
+				w.Write([]byte(cnt[:100]))
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte(cnt))
+		})
+
+		// Headers of the recorded result are those actually sent.
+		if d := w.Result().Header.Get(headerCompressionDecision); d != e.decision {
+			t.Errorf(`negronicompress.compress.ServeHTTP() of %s response sent %s %q, want %q`, e.name, headerCompressionDecision, d, e.decision)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// compressFS is a file system caching compressed variants of the files of
+// another file system.
+type compressFS struct {
+	fsys fs.FS
+	h    *compress
+	mu   sync.Mutex
+	// files holds cached files by their path.
+	files map[string]*fsFile
+}
+
+// fsFile is a cached file together with its compressed variants.
+type fsFile struct {
+	// h is the middleware whose rules the file is compressed by.
+	h           *compress
+	once        sync.Once
+	err         error
+	modTime     time.Time
+	contentType string
+	// compressible reports whether the file is worth compressing at all.
+	compressible bool
+	mu           sync.Mutex
+	// variants holds the content of the file by its encoding, with the
+	// original content under an empty encoding. Encodings that did not save
+	// enough are held as nil.
+	variants map[string]*fsVariant
+}
+
+// fsVariant is the content of a file in one of its encodings.
+type fsVariant struct {
+	b    []byte
+	etag string
+}
+
+// FS returns a file system serving the files of fsys, such as an embed.FS,
+// that is also an http.Handler. The handler serves each file compressed with
+// the encoding the client prefers, compressing it only on the first request
+// for that encoding and then keeping the result. It follows the content type
+// rules, minimum size, signatures, levels and savings set on the middleware.
+// Every encoding of a file is sent with its own strong "ETag" derived from a
+// hash of its content, and conditional and range requests are supported.
+//
+// The files of fsys are expected not to change. Files that should be compressed
+// before the first request can be prepared with Precompress.
+func (h *compress) FS(fsys fs.FS) *compressFS {
+	return &compressFS{fsys: fsys, h: h, files: make(map[string]*fsFile)}
+}
+
+// Open implements fs.FS by opening the original file.
+func (c *compressFS) Open(name string) (fs.File, error) {
+	return c.fsys.Open(name)
+}
+
+// Precompress compresses all files of the file system with every supported
+// encoding right away, instead of on their first request.
+func (c *compressFS) Precompress() error {
+	return fs.WalkDir(c.fsys, `.`, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		f, err := c.file(name)
+		if err != nil {
+			return err
+		}
+		for _, encoding := range supportedEncodings {
+			if _, err = f.variant(encoding); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (c *compressFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveStatic(w, r, func(name string) (staticFile, error) {
+		return c.file(name)
+	})
+}
+
+// file returns the cached file of the given name, reading it on first use.
+func (c *compressFS) file(name string) (*fsFile, error) {
+	c.mu.Lock()
+	f, ok := c.files[name]
+	if !ok {
+		f = &fsFile{h: c.h}
+		c.files[name] = f
+	}
+	c.mu.Unlock()
+
+	f.once.Do(func() {
+		f.err = f.load(c.fsys, name)
+	})
+	if f.err != nil {
+		// Names come from clients, so failures must not pile up in the cache.
+		c.mu.Lock()
+		if c.files[name] == f {
+			delete(c.files, name)
+		}
+		c.mu.Unlock()
+		return nil, f.err
+	}
+	return f, nil
+}
+
+// load reads the file of the given name from fsys and decides whether it is
+// worth compressing according to the rules of the middleware.
+func (f *fsFile) load(fsys fs.FS, name string) error {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fs.ErrNotExist
+	}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	f.modTime = fi.ModTime()
+	if f.contentType = mime.TypeByExtension(path.Ext(name)); f.contentType == `` {
+		f.contentType = http.DetectContentType(b)
+	}
+	f.compressible = len(b) > mininumContentLength &&
+		f.h.compressContentTypeRegEx.MatchString(f.contentType) &&
+		!f.h.isCompressed(b) &&
+		(f.h.entropyThreshold == 0 || entropy(b) < f.h.entropyThreshold)
+	f.variants = map[string]*fsVariant{``: newFSVariant(b)}
+	return nil
+}
+
+// info implements staticFile.
+func (f *fsFile) info() (string, []string) {
+	if f.compressible {
+		return f.contentType, supportedEncodings
+	}
+
+	return f.contentType, nil
+}
+
+// open implements staticFile. Content not worth compressing is returned in
+// its original form.
+func (f *fsFile) open(encoding string) (staticContent, error) {
+	v, err := f.variant(encoding)
+	if err != nil {
+		return staticContent{}, err
+	}
+	if v == nil {
+		encoding = ``
+		v, _ = f.variant(encoding)
+	}
+
+	return staticContent{ReadSeeker: bytes.NewReader(v.b), encoding: encoding, etag: v.etag, modTime: f.modTime}, nil
+}
+
+// variant returns the content of the file encoded with encoding, compressing
+// it with the level set on the middleware on first use. It returns nil if
+// compression does not save enough.
+func (f *fsFile) variant(encoding string) (*fsVariant, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if v, ok := f.variants[encoding]; ok {
+		return v, nil
+	}
+	if !f.compressible {
+		return nil, nil
+	}
+
+	src := f.variants[``].b
+	var buf bytes.Buffer
+	level := f.h.ruleLevel(encoding, f.contentType)
+	_, err := f.h.compressContent(context.Background(), &buf, encoding, level, bytes.NewReader(src), int64(len(src)))
+	switch {
+	case err == errNoSavings:
+		f.variants[encoding] = nil
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	v := newFSVariant(buf.Bytes())
+	f.variants[encoding] = v
+	return v, nil
+}
+
+// newFSVariant returns a variant of content b with a strong entity tag derived
+// from its hash.
+func newFSVariant(b []byte) *fsVariant {
+	sum := sha256.Sum256(b)
+	return &fsVariant{b: b, etag: fmt.Sprintf(`"%x"`, sum[:16])}
+}
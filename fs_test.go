@@ -0,0 +1,149 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompress_FS(t *testing.T) {
+	cnt := strings.Repeat(`embedded content `, 1000)
+	fsys := fstest.MapFS{
+		`ui/index.html`: {Data: []byte(cnt)},
+		`ui/small.css`:  {Data: []byte(`body{}`)},
+		`ui/logo.png`:   {Data: []byte("\x89PNG\r\n\x1a\n" + cnt)},
+	}
+	handler := NewCompress().FS(fsys)
+
+	etags := make(map[string]bool)
+	for _, e := range []struct {
+		path, accept string
+		code         int
+		encoding     string
+		body         string
+	}{
+		{`/ui/`, `gzip, deflate`, http.StatusOK, headerGzip, cnt},
+		{`/ui/index.html`, `deflate`, http.StatusOK, headerDeflate, cnt},
+		{`/ui/index.html`, `gzip;q=0`, http.StatusOK, ``, cnt},
+		{`/ui/index.html`, `gzip`, http.StatusOK, headerGzip, cnt},
+		{`/ui/small.css`, `gzip`, http.StatusOK, ``, `body{}`},
+		{`/ui/logo.png`, `gzip`, http.StatusOK, ``, "\x89PNG\r\n\x1a\n" + cnt},
+		{`/ui/missing.js`, `gzip`, http.StatusNotFound, ``, ``},
+		{`/ui`, `gzip`, http.StatusNotFound, ``, ``},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost`+e.path, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		ce := w.Header().Get(headerContentEncoding)
+		if w.Code != e.code || ce != e.encoding {
+			t.Errorf(`negronicompress.compressFS.ServeHTTP() for %s with %q = %d, %q; want %d, %q`, e.path, e.accept, w.Code, ce, e.code, e.encoding)
+			continue
+		}
+		if e.code != http.StatusOK {
+			continue
+		}
+		b := w.Body.Bytes()
+		if ce != `` {
+			dec, _ := NewDecoder(w.Body, ce)
+			b, _ = io.ReadAll(dec)
+		}
+		if string(b) != e.body {
+			t.Errorf(`negronicompress.compressFS.ServeHTTP() for %s with %q decoded to %d bytes, want %d`, e.path, e.accept, len(b), len(e.body))
+		}
+		if e.path == `/ui/index.html` {
+			etags[w.Header().Get(headerETag)] = true
+		}
+	}
+	// Every encoding of the same file needs its own strong ETag.
+	if len(etags) != 3 {
+		t.Errorf(`negronicompress.compressFS.ServeHTTP() sent %d distinct ETags, want 3`, len(etags))
+	}
+}
+
+func TestCompressFS_NotFound(t *testing.T) {
+	handler := NewCompress().FS(fstest.MapFS{`dir/a.txt`: {Data: []byte(`a`)}})
+	for _, path := range []string{`/missing.txt`, `/other.txt`, `/dir`, `/dir/`, `/..%2f`} {
+		req, _ := http.NewRequest(`GET`, `http://localhost`+path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf(`negronicompress.compressFS.ServeHTTP() for %s = %d, want %d`, path, w.Code, http.StatusNotFound)
+		}
+	}
+
+	if n := len(handler.files); n != 0 {
+		t.Errorf(`negronicompress.compressFS.ServeHTTP() cached %d missing files, want 0`, n)
+	}
+}
+
+func TestCompressFS_Precompress(t *testing.T) {
+	fsys := fstest.MapFS{
+		`a.txt`:     {Data: []byte(strings.Repeat(`a`, 4096))},
+		`dir/b.txt`: {Data: []byte(`b`)},
+	}
+	handler := NewCompress().FS(fsys)
+	if err := handler.Precompress(); err != nil {
+		t.Fatalf(`negronicompress.compressFS.Precompress() = %v, want nil`, err)
+	}
+
+	for name, n := range map[string]int{`a.txt`: len(supportedEncodings) + 1, `dir/b.txt`: 1} {
+		f, ok := handler.files[name]
+		if !ok {
+			t.Errorf(`negronicompress.compressFS.Precompress() did not cache %s`, name)
+		} else if len(f.variants) != n {
+			t.Errorf(`negronicompress.compressFS.Precompress() cached %d variants of %s, want %d`, len(f.variants), name, n)
+		}
+	}
+
+	if err := fstest.TestFS(handler, `a.txt`, `dir/b.txt`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompressFS_Range(t *testing.T) {
+	cnt := strings.Repeat(`2016-01-02 15:04:05 INFO resumable download `, 1000)
+	m := NewCompress()
+	handler := m.Handler(m.FS(fstest.MapFS{`app.log`: {Data: []byte(cnt)}}))
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/app.log`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	full, etag := w.Body.Bytes(), w.Header().Get(headerETag)
+	if ce, ar := w.Header().Get(headerContentEncoding), w.Header().Get(headerAcceptRanges); ce != headerGzip || ar != `bytes` {
+		t.Fatalf(`negronicompress.compressFS.ServeHTTP() behind middleware = %s %q, %s %q; want %q, %q`, headerContentEncoding, ce, headerAcceptRanges, ar, headerGzip, `bytes`)
+	}
+
+	for _, e := range []struct {
+		rng, ifRange string
+		code         int
+		body         []byte
+		contentRange string
+	}{
+		{`bytes=100-`, etag, http.StatusPartialContent, full[100:], fmt.Sprintf(`bytes 100-%d/%d`, len(full)-1, len(full))},
+		{`bytes=0-99`, ``, http.StatusPartialContent, full[:100], fmt.Sprintf(`bytes 0-99/%d`, len(full))},
+		{`bytes=100-`, `W/` + etag, http.StatusOK, full, ``},
+		{`bytes=100-`, `"stale"`, http.StatusOK, full, ``},
+	} {
+		req.Header.Set(`Range`, e.rng)
+		req.Header.Set(`If-Range`, e.ifRange)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		cr := w.Header().Get(`Content-Range`)
+		if w.Code != e.code || !bytes.Equal(w.Body.Bytes(), e.body) || cr != e.contentRange || w.Header().Get(headerContentEncoding) != headerGzip {
+			t.Errorf(`negronicompress.compressFS.ServeHTTP() behind middleware with range %q and If-Range %q = %d, %d bytes, %q; want %d, %d bytes, %q`, e.rng, e.ifRange, w.Code, w.Body.Len(), cr, e.code, len(e.body), e.contentRange)
+		}
+	}
+}
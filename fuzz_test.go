@@ -0,0 +1,115 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzNegotiateEncoding(f *testing.F) {
+	for _, s := range []string{``, `gzip`, `gzip, deflate`, `deflate;q=0.5, gzip;q=1.0`, `*;q=0`, `gzip;q=0, *`, `br;q=1e-3, *;q=.1`, `;;,,q=`} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, acceptEncoding string) {
+		enc := negotiateEncoding(acceptEncoding)
+		if enc == `` {
+			return
+		}
+
+		supported := false
+		for _, e := range supportedEncodings {
+			supported = supported || e == enc
+		}
+		if !supported {
+			t.Fatalf(`negronicompress.negotiateEncoding(%q) = %q, which is not supported`, acceptEncoding, enc)
+		}
+
+		for _, c := range strings.Split(acceptEncoding, `,`) {
+			if name, q := parseCoding(c); q > 0 && (name == enc || name == `*`) {
+				return
+			}
+		}
+		t.Fatalf(`negronicompress.negotiateEncoding(%q) = %q, which is not accepted`, acceptEncoding, enc)
+	})
+}
+
+func FuzzAppendFileType(f *testing.F) {
+	for _, s := range []string{`text/*`, `*/*`, `application/xhtml+xml`, `application/vnd.ms-excel`, `image/*+xml`, `xyz`, `\x`, `(/)`} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, c string) {
+		l, err := appendFileType(compressiableFileTypes, c)
+		if err != nil {
+			if len(l) != len(compressiableFileTypes) {
+				t.Fatalf(`negronicompress.appendFileType(_, %q) = %v, %v; want list unchanged`, c, l, err)
+			}
+			return
+		}
+
+		r, err := compileFileTypes(l)
+		if err != nil {
+			t.Fatalf(`negronicompress.compileFileTypes(%q) = _, %v; want _, nil`, l, err)
+		}
+		if contentType := strings.Replace(c, `*`, `x`, -1); !r.MatchString(contentType) {
+			t.Fatalf(`negronicompress.compileFileTypes(%q).MatchString(%q) = false, want true`, l, contentType)
+		}
+	})
+}
+
+func FuzzCompress_ServeHTTP(f *testing.F) {
+	text := []byte(strings.Repeat(`Fuzzed content. `, 200))
+	f.Add(text, `text/plain; charset=utf-8`, `gzip`, 0)
+	f.Add(text, `text/html`, `deflate`, 100)
+	f.Add(text, `application/json`, `*`, 0)
+	f.Add([]byte("\x1f\x8b\x08\x00"), `text/plain`, `gzip, deflate`, 2)
+	f.Add([]byte{}, ``, `gzip;q=0`, 0)
+
+	handler := NewCompress()
+	f.Fuzz(func(t *testing.T, body []byte, contentType, acceptEncoding string, flush int) {
+		req := httptest.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, contentType)
+			if flush > 0 && flush < len(body) {
+				w.Write(body[:flush])
+				w.(http.Flusher).Flush()
+				w.Write(body[flush:])
+				return
+			}
+			w.Write(body)
+		})
+
+		enc := w.Header().Get(headerContentEncoding)
+		if enc != `` && enc != negotiateEncoding(acceptEncoding) {
+			t.Fatalf(`%s = %q for %s %q, want %q or none`, headerContentEncoding, enc, headerAcceptEncoding, acceptEncoding, negotiateEncoding(acceptEncoding))
+		}
+		if l := w.Header().Get(headerContentLength); l != `` && l != strconv.Itoa(w.Body.Len()) {
+			t.Fatalf(`%s = %q, want %d`, headerContentLength, l, w.Body.Len())
+		}
+
+		decoded := w.Body.Bytes()
+		if enc != `` {
+			r, err := NewDecoder(bytes.NewReader(decoded), enc)
+			if err != nil {
+				t.Fatalf(`negronicompress.NewDecoder(_, %q) = _, %v; want _, nil`, enc, err)
+			}
+			if decoded, err = io.ReadAll(r); err != nil {
+				t.Fatalf(`decoding %s content = %v, want nil`, enc, err)
+			}
+		}
+		if !bytes.Equal(decoded, body) {
+			t.Fatalf(`decoded %q content = %d bytes, want %d`, enc, len(decoded), len(body))
+		}
+	})
+}
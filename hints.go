@@ -0,0 +1,94 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerAcceptCH string = `Accept-CH`
+	headerDownlink string = `Downlink`
+	headerECT      string = `ECT`
+	headerSaveData string = `Save-Data`
+	// constrainedDownlink is the downlink bandwidth in megabits per second
+	// below which a client is considered constrained.
+	constrainedDownlink float64 = 1.5
+)
+
+// SetClientHints makes the middleware read the "Save-Data", "ECT" and
+// "Downlink" request headers. Clients asking to save data or reporting a slow
+// connection get their responses compressed at the given level, unless a
+// handler requested a different one, and responses larger than minSize bytes
+// are compressed for them. Responses then carry "Vary" and "Accept-CH" headers
+// so that caches and browsers take the hints into account.
+func (h *compress) SetClientHints(enabled bool, level, minSize int) {
+	h.clientHints, h.hintLevel, h.hintMinSize = enabled, level, minSize
+}
+
+// isConstrained reports whether the client sending r asks to save data or
+// reports a slow network connection.
+func isConstrained(r *http.Request) bool {
+	if strings.EqualFold(strings.TrimSpace(r.Header.Get(headerSaveData)), `on`) {
+		return true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(headerECT))) {
+	case `slow-2g`, `2g`, `3g`:
+		return true
+	}
+
+	if d, err := strconv.ParseFloat(strings.TrimSpace(r.Header.Get(headerDownlink)), 64); err == nil && d < constrainedDownlink {
+		return true
+	}
+
+	return false
+}
+
+// headerHasToken reports whether any value of header key contains token in its
+// comma separated list of tokens.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, `,`) {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addVary adds tokens to the "Vary" header of h unless they, or a wildcard, are
+// already present.
+func addVary(h http.Header, tokens ...string) {
+	if headerHasToken(h, headerVary, `*`) {
+		return
+	}
+
+	addTokens(h, headerVary, tokens...)
+}
+
+// addTokens adds tokens missing from the comma separated list of tokens of
+// header key of h.
+func addTokens(h http.Header, key string, tokens ...string) {
+	var missing []string
+	for _, t := range tokens {
+		if !headerHasToken(h, key, t) {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	if h.Get(key) == `` {
+		h.Set(key, strings.Join(missing, `, `))
+	} else {
+		h.Add(key, strings.Join(missing, `, `))
+	}
+}
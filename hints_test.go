@@ -0,0 +1,119 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsConstrained(t *testing.T) {
+	for _, e := range []struct {
+		key, value  string
+		constrained bool
+	}{
+		{``, ``, false},
+		{headerSaveData, `on`, true},
+		{headerSaveData, `off`, false},
+		{headerECT, `2g`, true},
+		{headerECT, `slow-2g`, true},
+		{headerECT, `4g`, false},
+		{headerDownlink, `0.5`, true},
+		{headerDownlink, `10`, false},
+		{headerDownlink, `abc`, false},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		if e.key != `` {
+			req.Header.Set(e.key, e.value)
+		}
+		if c := isConstrained(req); c != e.constrained {
+			t.Errorf(`negronicompress.isConstrained() with %s: %q = %t, want %t`, e.key, e.value, c, e.constrained)
+		}
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	for _, e := range []struct {
+		vary   []string
+		tokens []string
+		want   []string
+	}{
+		{nil, []string{headerAcceptEncoding}, []string{headerAcceptEncoding}},
+		{[]string{``}, []string{headerAcceptEncoding}, []string{headerAcceptEncoding}},
+		{[]string{`Origin`}, []string{headerAcceptEncoding}, []string{`Origin`, headerAcceptEncoding}},
+		{[]string{`origin, accept-encoding`}, []string{headerAcceptEncoding, headerECT}, []string{`origin, accept-encoding`, headerECT}},
+		{[]string{`*`}, []string{headerAcceptEncoding}, []string{`*`}},
+	} {
+		h := http.Header{}
+		for _, v := range e.vary {
+			h.Add(headerVary, v)
+		}
+		addVary(h, e.tokens...)
+		if v := h.Values(headerVary); strings.Join(v, `|`) != strings.Join(e.want, `|`) {
+			t.Errorf(`negronicompress.addVary(%q, %q) = %q, want %q`, e.vary, e.tokens, v, e.want)
+		}
+	}
+}
+
+func TestCompress_SetClientHints(t *testing.T) {
+	handler := NewCompressWithCompressionLevel(100)
+	handler.SetClientHints(true, LevelBest, 100)
+
+	for _, e := range []struct {
+		saveData string
+		size     int
+		skipped  SkipReason
+	}{
+		{``, 200, SkipMinSize},
+		{`on`, 200, ``},
+		{`on`, 50, SkipMinSize},
+		{`on`, 100, SkipMinSize},
+		{`on`, 101, ``},
+		// Invalid middleware level is used for clients that are not constrained.
+		{``, mininumContentLength + 1, SkipError},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		req.Header.Set(headerSaveData, e.saveData)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Write([]byte(strings.Repeat(`.`, e.size)))
+		})
+		if res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.Result.Skipped with %s: %q and %d bytes = %q, want %q`, headerSaveData, e.saveData, e.size, res.Skipped, e.skipped)
+		}
+		for _, v := range []string{headerAcceptEncoding, headerSaveData, headerECT, headerDownlink} {
+			if !headerHasToken(w.Header(), headerVary, v) {
+				t.Errorf(`httptest.NewRecorder().Header().Values(%q) = %q, want %q included`, headerVary, w.Header().Values(headerVary), v)
+			}
+		}
+		if a := w.Header().Get(headerAcceptCH); a != `ECT, Downlink` {
+			t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerAcceptCH, a, `ECT, Downlink`)
+		}
+	}
+}
+
+func TestCompress_SetClientHintsAcceptCH(t *testing.T) {
+	handler := NewCompress()
+	handler.SetClientHints(true, LevelBest, 100)
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	w := httptest.NewRecorder()
+	w.Header().Set(headerAcceptCH, `Sec-CH-UA, ECT`)
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, v := range []string{`Sec-CH-UA`, headerECT, headerDownlink} {
+		if !headerHasToken(w.Header(), headerAcceptCH, v) {
+			t.Errorf(`httptest.NewRecorder().Header().Values(%q) = %q, want %q included`, headerAcceptCH, w.Header().Values(headerAcceptCH), v)
+		}
+	}
+	if a := w.Header().Values(headerAcceptCH); len(a) != 2 || a[1] != headerDownlink {
+		t.Errorf(`httptest.NewRecorder().Header().Values(%q) = %q, want %q`, headerAcceptCH, a, []string{`Sec-CH-UA, ECT`, headerDownlink})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// LevelFast is the compression level to request when speed matters more
+	// than size.
+	LevelFast int = flate.BestSpeed
+	// LevelBest is the compression level to request when size matters more
+	// than speed.
+	LevelBest int = flate.BestCompression
+)
+
+// levelRule assigns a compression level to responses of matching content type
+// and encoding.
+type levelRule struct {
+	// encoding is the encoding the rule applies to. Empty matches any.
+	encoding string
+	// contentTypes matches content types the rule applies to.
+	contentTypes *regexp.Regexp
+	// level is the compression level used for matching responses.
+	level int
+}
+
+// SetLevel sets the compression level used for responses compressed with
+// encoding whose content type matches any of c. Empty encoding matches any
+// encoding and no content types match any content type. Content types use the
+// same form as in AddContentType, but are matched without any parameters such
+// as charset. Rules set later take precedence over rules
+// set earlier, and responses not matching any rule use the level the
+// middleware was created with.
+//
+//	m.SetLevel(6, `gzip`)
+//	m.SetLevel(4, `deflate`)
+//	m.SetLevel(9, ``, `text/css`, `application/javascript`)
+//	m.SetLevel(1, ``, `application/json`)
+func (h *compress) SetLevel(level int, encoding string, c ...string) (err error) {
+	var cList []string
+	for _, t := range c {
+		cList, err = appendFileType(cList, t)
+		if err != nil {
+			return
+		}
+		// Match any type.
+		if len(cList) == 0 {
+			break
+		}
+	}
+
+	var r *regexp.Regexp
+	r, err = compileFileTypes(cList)
+	if err != nil {
+		return
+	}
+
+	h.levelRules = append(h.levelRules[:len(h.levelRules):len(h.levelRules)], levelRule{encoding, r, level})
+
+	return
+}
+
+// SetRequestLevel asks the middleware to compress the response to r at the
+// given level, for example LevelFast or LevelBest, regardless of the levels
+// set on the middleware. It is meant to be called by handlers further down the
+// chain and returns false if r was not passed through the middleware.
+func SetRequestLevel(r *http.Request, level int) bool {
+	res, ok := ResultFromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	res.level, res.hasLevel = level, true
+	return true
+}
+
+// level returns the compression level for a response to be compressed with
+// encoding of the given content type, and false if compression should be
+// skipped because of load.
+func (h *compress) level(res *Result, encoding, contentType string) (int, bool) {
+	var level int
+	if res.hasLevel {
+		level = res.level
+	} else if res.constrained {
+		level = h.hintLevel
+	} else {
+		level = h.ruleLevel(encoding, contentType)
+	}
+
+	// Under load, never go above the level chosen by the controller.
+	if h.adaptive != nil {
+		l, ok := h.adaptive.Level()
+		if !ok {
+			return 0, false
+		}
+		if levelIndex(l) < levelIndex(level) {
+			level = l
+		}
+	}
+
+	return level, true
+}
+
+// ruleLevel returns the compression level set on the middleware for content of
+// the given content type compressed with encoding.
+func (h *compress) ruleLevel(encoding, contentType string) int {
+	mediaType := contentType
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = strings.TrimSpace(mediaType[:i])
+	}
+	for i := len(h.levelRules) - 1; i >= 0; i-- {
+		rule := h.levelRules[i]
+		if (rule.encoding == `` || rule.encoding == encoding) && rule.contentTypes.MatchString(mediaType) {
+			return rule.level
+		}
+	}
+
+	return h.compressionLevel
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompress_SetLevel(t *testing.T) {
+	handler := NewCompressWithCompressionLevel(5)
+	if err := handler.SetLevel(1, ``, `xyz`); err == nil {
+		t.Errorf(`negronicompress.compress.SetLevel(1, "", %q) = nil, want err`, `xyz`)
+	}
+	for _, e := range []struct {
+		level    int
+		encoding string
+		c        []string
+	}{
+		{6, headerGzip, nil},
+		{4, headerDeflate, nil},
+		{9, ``, []string{`text/css`, `application/javascript`}},
+		{1, ``, []string{`application/json`}},
+		{2, headerDeflate, []string{`text/*`}},
+	} {
+		if err := handler.SetLevel(e.level, e.encoding, e.c...); err != nil {
+			t.Fatalf(`negronicompress.compress.SetLevel(%d, %q, %v) = %v, want nil`, e.level, e.encoding, e.c, err)
+		}
+	}
+
+	for _, e := range []struct {
+		encoding, contentType string
+		level                 int
+	}{
+		{headerGzip, `text/html`, 6},
+		{headerDeflate, `application/xhtml+xml`, 4},
+		{headerGzip, `text/css`, 9},
+		{headerDeflate, `text/css`, 2},
+		{headerGzip, `application/javascript; charset=utf-8`, 9},
+		{headerDeflate, `application/json`, 1},
+		{`br`, `image/svg+xml`, 5},
+	} {
+		if l, ok := handler.level(&Result{}, e.encoding, e.contentType); !ok || l != e.level {
+			t.Errorf(`negronicompress.compress.level(_, %q, %q) = %d, %t; want %d, true`, e.encoding, e.contentType, l, ok, e.level)
+		}
+	}
+
+	// Request override wins over rules.
+	if l, _ := handler.level(&Result{level: LevelFast, hasLevel: true}, headerGzip, `text/css`); l != LevelFast {
+		t.Errorf(`negronicompress.compress.level() with requested level = %d, want %d`, l, LevelFast)
+	}
+
+	// Controller caps levels under load.
+	a := NewAdaptiveLevel(flate.HuffmanOnly, 3)
+	a.adjusted.Store(time.Now().Add(time.Hour).UnixNano())
+	handler.SetAdaptiveLevel(a)
+	if l, _ := handler.level(&Result{}, headerGzip, `text/css`); l != 3 {
+		t.Errorf(`negronicompress.compress.level() with controller = %d, want %d`, l, 3)
+	}
+	if l, _ := handler.level(&Result{}, headerDeflate, `application/json`); l != 1 {
+		t.Errorf(`negronicompress.compress.level() with controller = %d, want %d`, l, 1)
+	}
+}
+
+func TestSetRequestLevel(t *testing.T) {
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	if SetRequestLevel(req, LevelBest) {
+		t.Error(`negronicompress.SetRequestLevel() = true for request without middleware, want false`)
+	}
+
+	handler := NewCompressWithCompressionLevel(100)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	ctx, res := NewResultContext(req.Context())
+	var ok bool
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+		ok = SetRequestLevel(r, LevelBest)
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(strings.Repeat(`.`, mininumContentLength+1)))
+	})
+	if !ok {
+		t.Error(`negronicompress.SetRequestLevel() = false, want true`)
+	}
+	// The invalid middleware level would make compression fail.
+	if res.Encoding != headerGzip {
+		t.Errorf(`negronicompress.Result.Encoding = %q, want %q`, res.Encoding, headerGzip)
+	}
+}
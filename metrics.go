@@ -0,0 +1,318 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsNamespace is the prefix of every metric name exposed by Metrics.
+const metricsNamespace string = `negronicompress_`
+
+// otherContentType is the label of content types that cannot be parsed, so that
+// malformed values do not each create a series of their own.
+const otherContentType string = `other`
+
+// durationBuckets are the upper bounds in seconds of the compression time
+// histogram.
+var durationBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// ratioBuckets are the upper bounds of the compression ratio histogram. Ratio
+// is the compressed size divided by the original size, so lower is better.
+var ratioBuckets = []float64{.1, .2, .3, .4, .5, .6, .7, .8, .9, 1}
+
+// histogram is a lock-free histogram with fixed bucket upper bounds.
+type histogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	// sum holds the bits of a float64 value.
+	sum atomic.Uint64
+}
+
+// newHistogram returns a histogram with the given bucket upper bounds.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)),
+	}
+}
+
+// observe records value v in the histogram.
+func (h *histogram) observe(v float64) {
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// counters is a set of counters kept for a single encoding or content type.
+type counters struct {
+	compressed atomic.Uint64
+	bytesIn    atomic.Uint64
+	bytesOut   atomic.Uint64
+	// nanoseconds is the total time spent compressing.
+	nanoseconds atomic.Uint64
+}
+
+// Metrics holds the statistics collected by a single middleware instance. All
+// counters are updated without locking, so collection is safe and cheap from
+// concurrent requests.
+//
+// Metrics implements http.Handler and renders its values in the Prometheus
+// text exposition format.
+type Metrics struct {
+	// responses is the number of responses that passed through the middleware.
+	responses atomic.Uint64
+	// compressed is the number of responses sent in a compressed format.
+	compressed atomic.Uint64
+	// bytesIn is the total size of responses before compression.
+	bytesIn atomic.Uint64
+	// bytesOut is the total size of responses after compression.
+	bytesOut atomic.Uint64
+	// duration is the distribution of the time spent compressing a response.
+	duration *histogram
+	// ratio is the distribution of compression ratios.
+	ratio *histogram
+	// skipped maps a SkipReason to the number of responses skipped for it.
+	skipped sync.Map
+	// encodings maps an encoding name to its counters.
+	encodings sync.Map
+	// contentTypes maps a media type to its counters.
+	contentTypes sync.Map
+	// shadow holds the would-be results of compressions done in shadow mode.
+	shadow counters
+	// shadowDuration is the distribution of the time spent compressing in
+	// shadow mode.
+	shadowDuration *histogram
+	// shadowRatio is the distribution of compression ratios in shadow mode.
+	shadowRatio *histogram
+}
+
+// NewMetrics returns a new empty metrics collection.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		duration:       newHistogram(durationBuckets),
+		ratio:          newHistogram(ratioBuckets),
+		shadowDuration: newHistogram(durationBuckets),
+		shadowRatio:    newHistogram(ratioBuckets),
+	}
+}
+
+// counter returns the counter stored under key k in m, creating it on first
+// use.
+func counter(m *sync.Map, k interface{}) *atomic.Uint64 {
+	if c, ok := m.Load(k); ok {
+		return c.(*atomic.Uint64)
+	}
+	c, _ := m.LoadOrStore(k, new(atomic.Uint64))
+	return c.(*atomic.Uint64)
+}
+
+// counterSet returns the counters stored under key k in m, creating them on
+// first use.
+func counterSet(m *sync.Map, k string) *counters {
+	if c, ok := m.Load(k); ok {
+		return c.(*counters)
+	}
+	c, _ := m.LoadOrStore(k, new(counters))
+	return c.(*counters)
+}
+
+// response records a response passing through the middleware.
+func (m *Metrics) response() {
+	m.responses.Add(1)
+}
+
+// skip records a response that was not compressed because of reason.
+func (m *Metrics) skip(reason SkipReason) {
+	counter(&m.skipped, reason).Add(1)
+}
+
+// compress records a response of contentType compressed with encoding from in
+// to out bytes in time d.
+func (m *Metrics) compress(encoding, contentType string, in, out int, d time.Duration) {
+	m.compressed.Add(1)
+	m.bytesIn.Add(uint64(in))
+	m.bytesOut.Add(uint64(out))
+	m.duration.observe(d.Seconds())
+	if in > 0 {
+		m.ratio.observe(float64(out) / float64(in))
+	}
+
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = t
+	} else {
+		contentType = otherContentType
+	}
+	for _, c := range []*counters{counterSet(&m.encodings, encoding), counterSet(&m.contentTypes, contentType)} {
+		c.compressed.Add(1)
+		c.bytesIn.Add(uint64(in))
+		c.bytesOut.Add(uint64(out))
+		c.nanoseconds.Add(uint64(d))
+	}
+}
+
+// shadowCompress records a response that would have been compressed from in to
+// out bytes in time d when running in shadow mode.
+func (m *Metrics) shadowCompress(in, out int, d time.Duration) {
+	m.shadow.compressed.Add(1)
+	m.shadow.bytesIn.Add(uint64(in))
+	m.shadow.bytesOut.Add(uint64(out))
+	m.shadow.nanoseconds.Add(uint64(d))
+	m.shadowDuration.observe(d.Seconds())
+	if in > 0 {
+		m.shadowRatio.observe(float64(out) / float64(in))
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set(headerContentType, `text/plain; version=0.0.4; charset=utf-8`)
+	m.WriteTo(rw)
+}
+
+// WriteTo writes all metrics to w in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	bw := &countWriter{w: buf}
+
+	writeFamily(bw, `responses_total`, `counter`, `Responses that passed through the middleware.`)
+	writeSample(bw, `responses_total`, ``, float64(m.responses.Load()))
+	writeFamily(bw, `compressed_total`, `counter`, `Responses sent in a compressed format.`)
+	writeSample(bw, `compressed_total`, ``, float64(m.compressed.Load()))
+	writeFamily(bw, `skipped_total`, `counter`, `Responses sent without compression by reason.`)
+	for _, k := range sortedKeys(&m.skipped) {
+		c, _ := m.skipped.Load(SkipReason(k))
+		writeSample(bw, `skipped_total`, label(`reason`, k), float64(c.(*atomic.Uint64).Load()))
+	}
+	writeFamily(bw, `bytes_in_total`, `counter`, `Size of compressed responses before compression.`)
+	writeSample(bw, `bytes_in_total`, ``, float64(m.bytesIn.Load()))
+	writeFamily(bw, `bytes_out_total`, `counter`, `Size of compressed responses after compression.`)
+	writeSample(bw, `bytes_out_total`, ``, float64(m.bytesOut.Load()))
+	writeHistogram(bw, `compression_seconds`, `Time spent compressing a response.`, m.duration)
+	writeHistogram(bw, `compression_ratio`, `Compressed size divided by original size.`, m.ratio)
+	writeCounterSets(bw, `encoding`, `encoding`, &m.encodings)
+	writeCounterSets(bw, `content_type`, `content_type`, &m.contentTypes)
+	writeFamily(bw, `shadow_compressed_total`, `counter`, `Responses compressed in shadow mode.`)
+	writeSample(bw, `shadow_compressed_total`, ``, float64(m.shadow.compressed.Load()))
+	writeFamily(bw, `shadow_bytes_in_total`, `counter`, `Size of responses before compression in shadow mode.`)
+	writeSample(bw, `shadow_bytes_in_total`, ``, float64(m.shadow.bytesIn.Load()))
+	writeFamily(bw, `shadow_bytes_out_total`, `counter`, `Size of responses after compression in shadow mode.`)
+	writeSample(bw, `shadow_bytes_out_total`, ``, float64(m.shadow.bytesOut.Load()))
+	writeHistogram(bw, `shadow_compression_seconds`, `Time spent compressing a response in shadow mode.`, m.shadowDuration)
+	writeHistogram(bw, `shadow_compression_ratio`, `Compressed size divided by original size in shadow mode.`, m.shadowRatio)
+
+	if err := buf.Flush(); err != nil {
+		return bw.n, err
+	}
+	return bw.n, bw.err
+}
+
+// countWriter counts bytes written to w and remembers the first error.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
+
+// sortedKeys returns the keys of m as sorted strings.
+func sortedKeys(m *sync.Map) []string {
+	var keys []string
+	m.Range(func(k, _ interface{}) bool {
+		switch k := k.(type) {
+		case string:
+			keys = append(keys, k)
+		case SkipReason:
+			keys = append(keys, string(k))
+		}
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// labelEscaper escapes label values as required by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label returns a single formatted name="value" label pair.
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// writeFamily writes the HELP and TYPE lines of a metric family.
+func writeFamily(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsNamespace, name, help, metricsNamespace, name, typ)
+}
+
+// writeSample writes a single sample line.
+func writeSample(w io.Writer, name, labels string, v float64) {
+	if labels != `` {
+		labels = `{` + labels + `}`
+	}
+	fmt.Fprintf(w, "%s%s%s %s\n", metricsNamespace, name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// writeHistogram writes all samples of histogram h.
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	writeFamily(w, name, `histogram`, help)
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += h.counts[i].Load()
+		writeSample(w, name+`_bucket`, label(`le`, strconv.FormatFloat(b, 'g', -1, 64)), float64(cumulative))
+	}
+	count := h.count.Load()
+	writeSample(w, name+`_bucket`, label(`le`, `+Inf`), float64(count))
+	writeSample(w, name+`_sum`, ``, math.Float64frombits(h.sum.Load()))
+	writeSample(w, name+`_count`, ``, float64(count))
+}
+
+// writeCounterSets writes the counters kept per encoding or content type.
+func writeCounterSets(w io.Writer, prefix, labelName string, m *sync.Map) {
+	keys := sortedKeys(m)
+	for _, f := range []struct {
+		name, help string
+		value      func(c *counters) float64
+	}{
+		{`compressed_total`, `Responses compressed per ` + labelName + `.`, func(c *counters) float64 { return float64(c.compressed.Load()) }},
+		{`bytes_in_total`, `Size before compression per ` + labelName + `.`, func(c *counters) float64 { return float64(c.bytesIn.Load()) }},
+		{`bytes_out_total`, `Size after compression per ` + labelName + `.`, func(c *counters) float64 { return float64(c.bytesOut.Load()) }},
+		{`compression_seconds_total`, `Time spent compressing per ` + labelName + `.`, func(c *counters) float64 { return time.Duration(c.nanoseconds.Load()).Seconds() }},
+	} {
+		name := prefix + `_` + f.name
+		writeFamily(w, name, `counter`, f.help)
+		for _, k := range keys {
+			c, _ := m.Load(k)
+			writeSample(w, name, label(labelName, k), f.value(c.(*counters)))
+		}
+	}
+}
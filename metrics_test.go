@@ -0,0 +1,131 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := newHistogram([]float64{1, 2})
+	for _, v := range []float64{.5, 1, 1.5, 3} {
+		h.observe(v)
+	}
+
+	for i, e := range []uint64{2, 1} {
+		if c := h.counts[i].Load(); c != e {
+			t.Errorf(`negronicompress.histogram.counts[%d] = %d, want %d`, i, c, e)
+		}
+	}
+	if c := h.count.Load(); c != 4 {
+		t.Errorf(`negronicompress.histogram.count = %d, want %d`, c, 4)
+	}
+}
+
+func TestMetrics_WriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.response()
+	m.response()
+	m.skip(SkipMinSize)
+	m.compress(headerGzip, `text/html; charset=utf-8`, 1000, 250, time.Millisecond)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf(`negronicompress.Metrics.WriteTo() = _, %v; want _, nil`, err)
+	}
+	for _, e := range []string{
+		"negronicompress_responses_total 2\n",
+		"negronicompress_compressed_total 1\n",
+		"negronicompress_skipped_total{reason=\"min-size\"} 1\n",
+		"negronicompress_bytes_in_total 1000\n",
+		"negronicompress_bytes_out_total 250\n",
+		"negronicompress_compression_seconds_bucket{le=\"0.001\"} 1\n",
+		"negronicompress_compression_ratio_bucket{le=\"0.2\"} 0\n",
+		"negronicompress_compression_ratio_bucket{le=\"0.3\"} 1\n",
+		"negronicompress_compression_ratio_count 1\n",
+		"negronicompress_encoding_bytes_out_total{encoding=\"gzip\"} 250\n",
+		"negronicompress_content_type_compressed_total{content_type=\"text/html\"} 1\n",
+		"# TYPE negronicompress_compression_seconds histogram\n",
+	} {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf(`negronicompress.Metrics.WriteTo() output does not contain %q`, e)
+		}
+	}
+}
+
+func TestMetrics_ContentType(t *testing.T) {
+	m := NewMetrics()
+	for _, c := range []string{`text/plain`, `Text/Plain; charset=utf-8`, `text/plain; charset`, `text/"x"`} {
+		m.compress(headerGzip, c, 100, 10, time.Millisecond)
+	}
+
+	for _, e := range []struct {
+		label string
+		n     uint64
+	}{
+		{`text/plain`, 2},
+		{otherContentType, 2},
+	} {
+		if n := counterSet(&m.contentTypes, e.label).compressed.Load(); n != e.n {
+			t.Errorf(`negronicompress.Metrics.contentTypes[%q].compressed = %d, want %d`, e.label, n, e.n)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if l := label(`a`, "x\"y\\z\n"); l != `a="x\"y\\z\n"` {
+		t.Errorf(`negronicompress.label(%q, %q) = %q, want %q`, `a`, "x\"y\\z\n", l, `a="x\"y\\z\n"`)
+	}
+}
+
+func TestCompress_Metrics(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		accept, contentType, body string
+	}{
+		{``, `text/plain`, cnt},
+		{headerGzip, `text/plain`, `.`},
+		{headerGzip, `image/png`, cnt},
+		{headerGzip, `text/plain`, cnt},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		handler.ServeHTTP(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, e.contentType)
+			w.Write([]byte(e.body))
+		})
+	}
+
+	m := handler.Metrics()
+	if m == nil {
+		t.Fatal(`negronicompress.NewCompress().Metrics() cannot return nil`)
+	}
+	if n := m.responses.Load(); n != 4 {
+		t.Errorf(`negronicompress.Metrics.responses = %d, want %d`, n, 4)
+	}
+	if n := m.compressed.Load(); n != 1 {
+		t.Errorf(`negronicompress.Metrics.compressed = %d, want %d`, n, 1)
+	}
+	for _, r := range []SkipReason{SkipNotAccepted, SkipMinSize, SkipContentType} {
+		if n := counter(&m.skipped, r).Load(); n != 1 {
+			t.Errorf(`negronicompress.Metrics.skipped[%q] = %d, want %d`, r, n, 1)
+		}
+	}
+	if n := m.bytesIn.Load(); n != uint64(len(cnt)) {
+		t.Errorf(`negronicompress.Metrics.bytesIn = %d, want %d`, n, len(cnt))
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, nil)
+	if h := w.Header().Get(headerContentType); !strings.HasPrefix(h, `text/plain; version=0.0.4`) {
+		t.Errorf(`negronicompress.Metrics.ServeHTTP() %s = %q, want %q`, headerContentType, h, `text/plain; version=0.0.4; charset=utf-8`)
+	}
+}
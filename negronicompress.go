@@ -5,47 +5,274 @@
 package negronicompress
 
 import (
+	"bytes"
 	"compress/flate"
-	"compress/gzip"
+	"context"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/negroni"
 )
 
 const (
 	headerAcceptEncoding  string = `Accept-Encoding`
+	headerAcceptRanges    string = `Accept-Ranges`
+	headerCacheControl    string = `Cache-Control`
 	headerContentEncoding string = `Content-Encoding`
 	headerContentLength   string = `Content-Length`
 	headerContentType     string = `Content-Type`
 	headerDeflate         string = `deflate`
+	headerETag            string = `ETag`
 	headerGzip            string = `gzip`
+	headerIdentity        string = `identity`
 	headerVary            string = `Vary`
 	// Minimum data size in bytes the response body must have in order to be
 	// considered for compression.
 	mininumContentLength int = 2048
 )
 
-// compressRegEx is a regular expression for supported content encoding types
-// that are checked against clients supported encoding types.
-var compressRegEx = regexp.MustCompile(`(,` + headerGzip + `,|,` + headerDeflate + `,)`)
+// SkipReason describes why a response was sent without compression.
+type SkipReason string
+
+const (
+	// SkipNotAccepted means the client does not accept any supported encoding.
+	SkipNotAccepted SkipReason = `not-accepted`
+	// SkipAlreadyEncoded means the response content was already encoded.
+	SkipAlreadyEncoded SkipReason = `already-encoded`
+	// SkipMinSize means the response content was too small to benefit from
+	// compression.
+	SkipMinSize SkipReason = `min-size`
+	// SkipContentType means the response content type is not in the list of
+	// compressiable file types.
+	SkipContentType SkipReason = `content-type`
+	// SkipError means compression failed and the original content was sent
+	// instead.
+	SkipError SkipReason = `error`
+	// SkipShadow means the middleware runs in shadow mode and only measures
+	// compression without changing the response.
+	SkipShadow SkipReason = `shadow`
+	// SkipAlreadyCompressed means the response content is in a format that is
+	// already compressed.
+	SkipAlreadyCompressed SkipReason = `already-compressed`
+	// SkipHighEntropy means the response content looks too random to benefit
+	// from compression.
+	SkipHighEntropy SkipReason = `high-entropy`
+	// SkipNoSavings means compression did not make the response content
+	// sufficiently smaller.
+	SkipNoSavings SkipReason = `no-savings`
+	// SkipOverload means compression was skipped to shed load.
+	SkipOverload SkipReason = `overload`
+	// SkipBudget means buffering the response content would exceed the memory
+	// budget.
+	SkipBudget SkipReason = `budget`
+	// SkipConcurrency means the maximum number of concurrent compressions was
+	// reached.
+	SkipConcurrency SkipReason = `concurrency`
+	// SkipCanceled means the client went away before compression finished, so
+	// nothing was sent.
+	SkipCanceled SkipReason = `canceled`
+	// SkipTimeout means compression took longer than allowed and the original
+	// content was sent instead.
+	SkipTimeout SkipReason = `timeout`
+	// SkipFlush means the handler flushed the response, so it was sent as is
+	// from then on.
+	SkipFlush SkipReason = `flush`
+	// SkipStatus means the response status code does not allow compression.
+	SkipStatus SkipReason = `status`
+	// SkipNoTransform means the response must not be transformed according to
+	// its "Cache-Control" header.
+	SkipNoTransform SkipReason = `no-transform`
+)
 
 // compressResponseWriter is the ResponseWriter that negroni.ResponseWriter is
 // wrapped in.
 type compressResponseWriter struct {
 	c []byte
 	negroni.ResponseWriter
+	// budget, if set, limits the amount of buffered data.
+	budget *Budget
+	// reserved is the number of bytes reserved from budget.
+	reserved int
+	// passthrough is set when buffering stopped and all data is written
+	// directly to the wrapped writer instead, or compressed on the fly if
+	// stream is set.
+	passthrough bool
+	// reason is the reason why buffering stopped.
+	reason SkipReason
+	// spillThreshold is the buffer size in bytes above which buffered data is
+	// moved to a temporary file. Zero means data is always kept in memory.
+	spillThreshold int64
+	// spillDir is the directory for temporary files. Empty means the default
+	// directory for temporary files is used.
+	spillDir string
+	// f is the temporary file holding buffered data once it was spilled. From
+	// then on c only holds the leading bytes of the data.
+	f *os.File
+	// n is the total number of buffered bytes.
+	n int64
+	// files is a list of temporary files to remove when done.
+	files []*os.File
+	// acceptEncoding is the value of the "Accept-Encoding" header of the
+	// request.
+	acceptEncoding string
+	// transcodeLimit is the maximum size of content encoded with an encoding
+	// the client does not accept that is buffered for transcoding. Zero means
+	// such content is never buffered.
+	transcodeLimit int64
+	// startStream, if set, is called when the handler flushes the response. It
+	// returns a writer compressing data on the fly, or the reason why the
+	// response is sent as is.
+	startStream func() (*streamWriter, SkipReason)
+	// stream is the writer compressing data on the fly once the handler
+	// flushed the response.
+	stream *streamWriter
+	// status is the status code written by the handler. It is held back until
+	// the response is sent, so that headers can still be changed.
+	status int
+	// explain is set when debug headers describing the compression decision
+	// should be added to the response.
+	explain bool
 }
 
-// Write appends any data to writers buffer.
+// Write appends any data to writers buffer. If the buffer cannot grow within
+// the budget, buffered data is sent uncompressed and buffering stops. Data
+// already encoded by the handler is not buffered at all, unless it may have to
+// be transcoded, and only up to the transcoding limit.
 func (m *compressResponseWriter) Write(b []byte) (int, error) {
+	if m.passthrough {
+		return m.sink().Write(b)
+	}
+	if m.n == 0 && m.f == nil {
+		// Content encoded by the handler is never encoded again, so there is
+		// no point in holding it back.
+		if e := m.Header().Get(headerContentEncoding); e != `` && (m.transcodeLimit == 0 || acceptsEncoding(m.acceptEncoding, e)) {
+			if err := m.pass(SkipAlreadyEncoded); err != nil {
+				return 0, err
+			}
+			return m.ResponseWriter.Write(b)
+		}
+	}
+	if m.transcodeLimit > 0 && m.n+int64(len(b)) > m.transcodeLimit && m.Header().Get(headerContentEncoding) != `` {
+		// Encoded content is hardly ever larger than decoded one, so it is
+		// not going to be transcoded anyway.
+		if err := m.pass(SkipAlreadyEncoded); err != nil {
+			return 0, err
+		}
+		return m.ResponseWriter.Write(b)
+	}
+	if m.f != nil {
+		// Keep leading bytes in memory for content sniffing.
+		if k := entropySampleSize - len(m.c); k > 0 {
+			m.c = append(m.c, b[:min(k, len(b))]...)
+		}
+		n, err := m.f.Write(b)
+		m.n += int64(n)
+		return n, err
+	}
+	if m.spillThreshold > 0 && m.n+int64(len(b)) > m.spillThreshold {
+		if err := m.spill(); err != nil {
+			// Content that cannot be buffered is sent as is.
+			if err = m.pass(SkipError); err != nil {
+				return 0, err
+			}
+			return m.ResponseWriter.Write(b)
+		}
+		return m.Write(b)
+	}
+	if !m.reserve(len(b)) {
+		if err := m.pass(SkipBudget); err != nil {
+			return 0, err
+		}
+		return m.ResponseWriter.Write(b)
+	}
+
 	m.c = append(m.c, b...)
+	m.n += int64(len(b))
 	return len(b), nil
 }
 
+// WriteHeader holds the status code back until the response is sent.
+// Informational status codes are sent right away.
+func (m *compressResponseWriter) WriteHeader(code int) {
+	switch {
+	case m.passthrough || (code >= 100 && code < 200 && code != http.StatusSwitchingProtocols):
+		m.ResponseWriter.WriteHeader(code)
+	case m.status == 0:
+		m.status = code
+	}
+}
+
+// Status returns the status code written by the handler.
+func (m *compressResponseWriter) Status() int {
+	if m.status != 0 {
+		return m.status
+	}
+
+	return m.ResponseWriter.Status()
+}
+
+// writeHeader sends the held back status code, if any.
+func (m *compressResponseWriter) writeHeader() {
+	if m.status != 0 {
+		m.ResponseWriter.WriteHeader(m.status)
+	}
+}
+
+// pass sends the held back status code and all buffered data to the wrapped
+// writer, or compresses it if stream is set, and stops buffering for reason.
+func (m *compressResponseWriter) pass(reason SkipReason) error {
+	m.passthrough, m.reason = true, reason
+	if m.explain && m.stream == nil {
+		explainResult(m.Header(), &Result{Skipped: reason})
+	}
+	m.writeHeader()
+
+	src, err := m.reader()
+	if err == nil {
+		_, err = io.Copy(m.sink(), src)
+	}
+	m.release()
+	m.cleanup()
+	m.c, m.n = []byte{}, 0
+	return err
+}
+
+// sink returns the writer data is written to once buffering stopped.
+func (m *compressResponseWriter) sink() io.Writer {
+	if m.stream != nil {
+		return m.stream
+	}
+
+	return m.ResponseWriter
+}
+
+// reserve reserves n more bytes from the budget, if any.
+func (m *compressResponseWriter) reserve(n int) bool {
+	if m.budget == nil {
+		return true
+	}
+	if !m.budget.reserve(n) {
+		return false
+	}
+
+	m.reserved += n
+	return true
+}
+
+// release returns all reserved bytes to the budget.
+func (m *compressResponseWriter) release() {
+	if m.budget != nil {
+		m.budget.release(m.reserved)
+		m.reserved = 0
+	}
+}
+
 // compress sends any output content back to client in a compressed format
 // whenever possible.
 type compress struct {
@@ -59,6 +286,68 @@ type compress struct {
 	// compressContentTypeRegEx is a list of file types that should be
 	// compressed compiled into a regular expression.
 	compressContentTypeRegEx *regexp.Regexp
+	// metrics holds statistics about responses handled by the middleware.
+	metrics *Metrics
+	// observer is notified about every compression decision.
+	observer Observer
+	// explain reports whether debug headers describing the compression
+	// decision should be added to the response of a request.
+	explain func(*http.Request) bool
+	// shadowRate is the fraction of responses compressed in the background
+	// when running in shadow mode. Zero disables shadow mode.
+	shadowRate float64
+	// shadowLevel is the compression level used in shadow mode.
+	shadowLevel int
+	// shadowSlots limits the number of background compressions running in
+	// shadow mode at the same time.
+	shadowSlots chan struct{}
+	// signatures is a list of signatures of already compressed formats that
+	// should not be compressed again.
+	signatures []Signature
+	// entropyThreshold is the estimated entropy in bits per byte at which
+	// content is considered incompressible. Zero disables the check.
+	entropyThreshold float64
+	// minSavings is the minimum fraction by which compression must reduce the
+	// size of the content for the compressed content to be sent.
+	minSavings float64
+	// savingsWindow is the size of the leading part of the content on which
+	// the savings are checked before the rest is compressed. Zero means the
+	// whole content is compressed before checking.
+	savingsWindow int
+	// spillThreshold is the size of buffered content above which it is moved
+	// to a temporary file. Zero keeps all content in memory.
+	spillThreshold int64
+	// spillDir is the directory for temporary files.
+	spillDir string
+	// parallelThreshold is the size of content above which it is compressed
+	// in parallel. Zero disables parallel compression.
+	parallelThreshold int64
+	// parallelBlockSize is the size of blocks compressed in parallel.
+	parallelBlockSize int
+	// parallelWorkers is the maximum number of blocks compressed at once.
+	parallelWorkers int
+	// levelRules is a list of rules overriding compressionLevel for responses
+	// of specific content types and encodings.
+	levelRules []levelRule
+	// clientHints enables reading of client hints about network quality.
+	clientHints bool
+	// hintLevel is the compression level for constrained clients.
+	hintLevel int
+	// hintMinSize is the minimum content size for constrained clients.
+	hintMinSize int
+	// adaptive, if set, adjusts the compression level to the current load
+	// instead of using compressionLevel.
+	adaptive *AdaptiveLevel
+	// budget, if set, limits memory used for buffering and the number of
+	// concurrent compressions.
+	budget *Budget
+	// maxCompressionTime is the maximum time a single response may be
+	// compressed for. Zero means no limit.
+	maxCompressionTime time.Duration
+	// transcodeLimit is the maximum decoded size of already encoded content
+	// that is transcoded to an encoding accepted by the client. Zero disables
+	// transcoding.
+	transcodeLimit int64
 }
 
 // NewCompress returns a new compress middleware instance with default
@@ -69,13 +358,51 @@ func NewCompress() *compress {
 
 // NewCompress returns a new compress middleware instance.
 func NewCompressWithCompressionLevel(level int) *compress {
-	return &compress{level, compressiableFileTypes, compressContentTypeRegEx}
+	return &compress{
+		compressionLevel:         level,
+		compressiableFileTypes:   compressiableFileTypes,
+		compressContentTypeRegEx: compressContentTypeRegEx,
+		signatures:               compressedSignatures,
+		metrics:                  NewMetrics(),
+		observer:                 nopObserver{},
+	}
+}
+
+// Metrics returns statistics collected by the middleware. The returned value
+// can be mounted as an http.Handler to expose them to Prometheus.
+func (h *compress) Metrics() *Metrics {
+	return h.metrics
+}
+
+// SetAdaptiveLevel makes the middleware use compression levels chosen by a
+// controller according to the current load. Levels set on the middleware are
+// then used only while they do not exceed the level chosen by the controller.
+// Passing nil restores the fixed levels.
+func (h *compress) SetAdaptiveLevel(a *AdaptiveLevel) {
+	h.adaptive = a
+}
+
+// SetBudget limits memory used for buffering responses and the number of
+// concurrent compressions. The same budget can be shared by several middleware
+// instances. Passing nil removes the limits.
+func (h *compress) SetBudget(b *Budget) {
+	h.budget = b
+}
+
+// SetObserver sets the observer notified about compression decisions made by
+// the middleware. Passing nil removes any previously set observer.
+func (h *compress) SetObserver(o Observer) {
+	if o == nil {
+		o = nopObserver{}
+	}
+	h.observer = o
 }
 
 // AddContentType adds a new file type to the middleware list of file types that
 // can be compressed. c should match the form used of a value used in
 // "Content-Type" HTTP header. If c is "*/*", it will reset the list to empty
-// value making it match all types, including no type.
+// value making it match all types, including no type. A "*" in c matches any
+// sequence of characters, while all other characters are matched literally.
 func (h *compress) AddContentType(c ...string) (err error) {
 	// XXX: This is copied from the helper function. Somehow remove code
 	// duplication. With pointers maybe?
@@ -101,72 +428,358 @@ func (h *compress) AddContentType(c ...string) (err error) {
 	return
 }
 
+// ServeHTTP implements negroni.Handler.
 func (h *compress) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	// Notify the user agent that we support content compression.
-	if rw.Header().Get(headerVary) == `` {
-		rw.Header().Set(headerVary, headerAcceptEncoding)
+	h.serve(rw, r, next)
+}
+
+// Handler returns an http.Handler that compresses responses of next. Together
+// with NewMiddleware, it allows the middleware to be used with net/http and
+// routers other than negroni.
+func (h *compress) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h.serve(rw, r, next)
+	})
+}
+
+// NewMiddleware returns a net/http middleware that compresses responses at the
+// given compression level. It is a shorthand for the Handler method of a new
+// middleware instance, when no further configuration is needed.
+func NewMiddleware(level int) func(http.Handler) http.Handler {
+	return NewCompressWithCompressionLevel(level).Handler
+}
+
+// serve compresses the response of next to r whenever possible.
+func (h *compress) serve(rw http.ResponseWriter, r *http.Request, next http.Handler) {
+	h.metrics.response()
+
+	// Make the outcome available to handlers further down the chain as well as
+	// to any middleware that prepared the context before calling us.
+	res, ok := ResultFromContext(r.Context())
+	if !ok {
+		var ctx context.Context
+		ctx, res = NewResultContext(r.Context())
+		r = r.WithContext(ctx)
+	}
+	explain := h.explain != nil && h.explain(r)
+
+	// Notify the user agent that we support content compression. Handlers may
+	// replace the header, so it is checked again right before it is sent.
+	vary := []string{headerAcceptEncoding}
+	if h.clientHints {
+		vary = append(vary, headerSaveData, headerECT, headerDownlink)
+	}
+	addVary(rw.Header(), vary...)
+	keepVary := func(w negroni.ResponseWriter) {
+		addVary(w.Header(), vary...)
+	}
+
+	// Be more aggressive for clients on slow or metered connections.
+	minSize := mininumContentLength
+	if h.clientHints {
+		addTokens(rw.Header(), headerAcceptCH, headerECT, headerDownlink)
+		if res.constrained = isConstrained(r); res.constrained {
+			minSize = h.hintMinSize
+		}
 	}
 
-	// Skip compression if content is already encoded.
-	if rw.Header().Get(headerContentEncoding) != `` {
-		next(rw, r)
+	// Skip compression if content is already encoded, unless it may have to be
+	// transcoded.
+	if rw.Header().Get(headerContentEncoding) != `` && h.transcodeLimit == 0 {
+		h.skip(r, res, SkipAlreadyEncoded)
+		if explain {
+			explainResult(rw.Header(), res)
+		}
+		next.ServeHTTP(withBefore(rw, keepVary), r)
+		addVary(rw.Header(), vary...)
 		return
 	}
 
 	// Check if client supports any kind of content compression in response. Do
-	// nothing and exit function if it doesn't.
-	acceptedEncoding := r.Header.Get(headerAcceptEncoding)
-	if acceptedEncoding == `` || !compressRegEx.MatchString(`,`+acceptedEncoding+`,`) {
-		next(rw, r)
+	// nothing and exit function if it doesn't, unless already encoded content
+	// may have to be decoded for it.
+	encoding := negotiateEncoding(r.Header.Get(headerAcceptEncoding))
+	if encoding == `` && h.transcodeLimit == 0 {
+		h.skip(r, res, SkipNotAccepted)
+		if explain {
+			explainResult(rw.Header(), res)
+		}
+		next.ServeHTTP(withBefore(rw, keepVary), r)
+		addVary(rw.Header(), vary...)
 		return
 	}
+	if encoding != `` {
+		res.Negotiated = encoding
+		h.observer.OnNegotiated(r, encoding)
+	}
 
 	// Wrap the original writer with a buffered one.
 	crw := &compressResponseWriter{
-		make([]byte, 0),
-		negroni.NewResponseWriter(rw),
+		c:              make([]byte, 0),
+		ResponseWriter: negroni.NewResponseWriter(rw),
+		budget:         h.budget,
+		spillThreshold: h.spillThreshold,
+		spillDir:       h.spillDir,
+		acceptEncoding: r.Header.Get(headerAcceptEncoding),
+		transcodeLimit: h.transcodeLimit,
+		explain:        explain,
 	}
+	crw.startStream = func() (*streamWriter, SkipReason) {
+		return h.startStream(r, res, crw, encoding)
+	}
+	crw.Before(keepVary)
 	defer func() {
+		if crw.stream != nil {
+			crw.stream.release()
+		}
+		crw.release()
+		crw.cleanup()
 		crw.c = []byte{}
 	}()
-	next(crw, r)
+	next.ServeHTTP(crw, r)
+	addVary(rw.Header(), vary...)
+
+	// Content was already sent if it was encoded, flushed by the handler or
+	// did not fit into the budget.
+	if crw.passthrough {
+		if crw.stream != nil {
+			h.finishStream(r, res, crw.stream)
+		} else {
+			h.skip(r, res, crw.reason)
+		}
+		return
+	}
+
+	// Content encoded by the handler is never encoded again, but may be
+	// decoded if the client does not accept its encoding.
+	encoded := crw.Header().Get(headerContentEncoding)
+	if encoded != `` && h.transcodeLimit > 0 && !acceptsEncoding(r.Header.Get(headerAcceptEncoding), encoded) &&
+		compressibleStatus(crw.status) && !headerHasToken(crw.Header(), headerCacheControl, `no-transform`) {
+		if ok, err := h.transcode(crw, encoded); err != nil {
+			h.observer.OnError(r, err)
+		} else if ok {
+			res.Decoded, encoded = encoded, ``
+		}
+	}
 
 	// Compress only if output content will benefit from compression and if we
 	// are allowed to compress the output content type.
-	if len(crw.c) > mininumContentLength && h.compressContentTypeRegEx.MatchString(crw.Header().Get(headerContentType)) {
-		var (
-			wc  io.WriteCloser
-			old []byte
-		)
-		old, crw.c = crw.c, []byte{}
-		for _, t := range strings.Split(acceptedEncoding, `,`) {
-			// Find compression method with highest priority.
-			switch t {
-			case headerGzip:
-				// TODO: Error checking.
-				wc, _ = gzip.NewWriterLevel(crw, h.compressionLevel)
-			case headerDeflate:
-				// TODO: Error checking.
-				wc, _ = flate.NewWriter(crw, h.compressionLevel)
-			default:
-				// TODO: Make a test for this.
-			}
-			// Check if any of the supported compression methods were found.
-			if wc != nil {
-				// Set response compression encoding based on the supported type
-				// we found.
-				rw.Header().Set(headerContentEncoding, t)
-				// TODO: Error checking.
-				wc.Write(old)
-				old = []byte{}
-				wc.Close()
-				// Set size of the compressed content.
-				rw.Header().Set(headerContentLength, strconv.FormatInt(int64(len(crw.c)), 10))
-				break
-			}
+	var (
+		out         io.Reader
+		n           int64
+		contentType = crw.Header().Get(headerContentType)
+	)
+	switch {
+	case encoded != ``:
+		h.skip(r, res, SkipAlreadyEncoded)
+	case encoding == ``:
+		h.skip(r, res, SkipNotAccepted)
+	case !compressibleStatus(crw.status):
+		h.skip(r, res, SkipStatus)
+	case headerHasToken(crw.Header(), headerCacheControl, `no-transform`):
+		h.skip(r, res, SkipNoTransform)
+	case crw.buffered() <= int64(minSize):
+		h.skip(r, res, SkipMinSize)
+	case !h.compressContentTypeRegEx.MatchString(contentType):
+		h.skip(r, res, SkipContentType)
+	case h.isCompressed(crw.head()):
+		h.skip(r, res, SkipAlreadyCompressed)
+	case h.entropyThreshold > 0 && entropy(crw.head()) >= h.entropyThreshold:
+		h.skip(r, res, SkipHighEntropy)
+	case h.shadowRate > 0:
+		h.skip(r, res, SkipShadow)
+		if crw.f == nil && rand.Float64() < h.shadowRate {
+			h.startShadow(r, encoding, crw)
 		}
+	default:
+		out, n = h.compressResponse(r, res, crw, encoding, contentType)
+	}
+	if res.Skipped == SkipCanceled {
+		// Nobody is listening anymore.
+		return
+	}
+
+	if out != nil {
+		// Set response compression encoding based on the supported type we
+		// found.
+		setEncoding(rw.Header(), encoding)
+		// Set size of the compressed content.
+		rw.Header().Set(headerContentLength, strconv.FormatInt(n, 10))
+	} else {
+		var err error
+		if out, err = crw.reader(); err != nil {
+			h.observer.OnError(r, err)
+			return
+		}
+		// Spilled content is usually too large to be sent without its size.
+		if crw.f != nil {
+			rw.Header().Set(headerContentLength, strconv.FormatInt(crw.buffered(), 10))
+		}
+	}
+
+	if explain {
+		explainResult(rw.Header(), res)
+	}
+	crw.writeHeader()
+	if _, err := io.Copy(rw, out); err != nil {
+		h.observer.OnError(r, err)
+	}
+}
+
+// withBefore returns rw with before registered to be called right before its
+// header is sent. Writers of a negroni chain are returned as they are, so that
+// handlers keep access to all of their methods, while other writers are
+// wrapped in one.
+func withBefore(rw http.ResponseWriter, before func(negroni.ResponseWriter)) http.ResponseWriter {
+	nrw, ok := rw.(negroni.ResponseWriter)
+	if !ok {
+		nrw = negroni.NewResponseWriter(rw)
+	}
+	nrw.Before(before)
+	return nrw
+}
+
+// compressResponse compresses content buffered in crw with encoding. It returns
+// a reader of the compressed content and its size, or nil if the original
+// content should be sent instead.
+func (h *compress) compressResponse(r *http.Request, res *Result, crw *compressResponseWriter, encoding, contentType string) (io.Reader, int64) {
+	if r.Context().Err() != nil {
+		h.skip(r, res, SkipCanceled)
+		return nil, 0
 	}
 
-	// TODO: Error checking.
-	rw.Write(crw.c)
+	level, ok := h.level(res, encoding, contentType)
+	if !ok {
+		h.skip(r, res, SkipOverload)
+		return nil, 0
+	}
+
+	// Compressed copy is held next to the original, so account for it as well.
+	// Content spilled to a file is compressed into a file too.
+	var (
+		w   io.Writer
+		buf *bytes.Buffer
+		f   *os.File
+	)
+	if h.budget != nil {
+		if !h.budget.acquire() {
+			h.skip(r, res, SkipConcurrency)
+			return nil, 0
+		}
+		defer h.budget.done()
+	}
+	if crw.f != nil {
+		var err error
+		if f, err = crw.tempFile(); err != nil {
+			h.observer.OnError(r, err)
+			h.skip(r, res, SkipError)
+			return nil, 0
+		}
+		w = f
+	} else {
+		if !crw.reserve(len(crw.c)) {
+			h.skip(r, res, SkipBudget)
+			return nil, 0
+		}
+		buf = bytes.NewBuffer(make([]byte, 0, len(crw.c)/2))
+		w = buf
+	}
+
+	ctx := r.Context()
+	if h.maxCompressionTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.maxCompressionTime)
+		defer cancel()
+	}
+
+	src, err := crw.reader()
+	if err == nil {
+		if h.adaptive != nil {
+			h.adaptive.begin()
+		}
+		start := time.Now()
+		res.OutSize, err = h.compressContent(ctx, w, encoding, level, src, crw.buffered())
+		res.Duration = time.Since(start)
+		if h.adaptive != nil {
+			h.adaptive.end(res.Duration)
+		}
+	}
+	switch {
+	case err == nil:
+	case err == errNoSavings:
+		h.skip(r, res, SkipNoSavings)
+		return nil, 0
+	case r.Context().Err() != nil:
+		h.skip(r, res, SkipCanceled)
+		return nil, 0
+	case err == context.DeadlineExceeded:
+		h.skip(r, res, SkipTimeout)
+		return nil, 0
+	default:
+		// Fall back to sending the original content.
+		h.observer.OnError(r, err)
+		h.skip(r, res, SkipError)
+		return nil, 0
+	}
+
+	res.Encoding, res.InSize = encoding, int(crw.buffered())
+	h.metrics.compress(encoding, contentType, res.InSize, res.OutSize, res.Duration)
+	h.observer.OnCompressed(r, encoding, res.InSize, res.OutSize, res.Duration)
+
+	if f != nil {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			h.observer.OnError(r, err)
+			return nil, 0
+		}
+		return f, int64(res.OutSize)
+	}
+	return buf, int64(res.OutSize)
+}
+
+// setEncoding marks a response with header h as encoded with encoding.
+func setEncoding(h http.Header, encoding string) {
+	h.Set(headerContentEncoding, encoding)
+	setTransformed(h)
+}
+
+// setTransformed marks a response with header h as having its content
+// transformed on the fly.
+func setTransformed(h http.Header) {
+	// Transformed content is a different representation, so it must not share
+	// a strong validator with the original one.
+	if etag := h.Get(headerETag); strings.HasPrefix(etag, `"`) {
+		h.Set(headerETag, `W/`+etag)
+	}
+	// Ranges can only be served from the original representation, which the
+	// client never gets to see.
+	h.Del(headerAcceptRanges)
+}
+
+// isCompressed reports whether b starts with a signature of an already
+// compressed format.
+func (h *compress) isCompressed(b []byte) bool {
+	_, ok := matchSignature(h.signatures, b)
+	return ok
+}
+
+// skip records that the response to r will not be compressed because of
+// reason.
+func (h *compress) skip(r *http.Request, res *Result, reason SkipReason) {
+	res.Skipped = reason
+	h.metrics.skip(reason)
+	h.observer.OnSkipped(r, reason)
+}
+
+// encode writes b to w encoded with encoding at the given compression level.
+func encode(w io.Writer, encoding string, level int, b []byte) error {
+	wc, err := newEncoder(w, encoding, level)
+	if err != nil {
+		return err
+	}
+
+	if _, err = wc.Write(b); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
 }
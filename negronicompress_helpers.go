@@ -5,14 +5,16 @@
 package negronicompress
 
 import (
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 // compressiableFileTypes is a list of "Content-Type" file types that should be
 // compressed. By default it uses some common file types passed as output on
 // modern HTML webpages.
-var compressiableFileTypes = []string{`text/.+`, `application/x-javascript`, `application/xhtml+xml`}
+var compressiableFileTypes = []string{`text/.+`, `application/x-javascript`, `application/xhtml\+xml`}
 
 // contentTypeRegEx is a regular expression for the allowed value to be passed
 // as compressionable file type.
@@ -34,7 +36,8 @@ func compileFileTypes(fileTypes []string) (*regexp.Regexp, error) {
 }
 
 // appendFileType adds c to a list of file types if c is not already present in
-// the list. If c is "*/*", it will return an empty list.
+// the list. If c is "*/*", it will return an empty list. Characters of c other
+// than "*" are matched literally.
 func appendFileType(fileTypes []string, c string) ([]string, error) {
 	if c == `*/*` {
 		return []string{}, nil
@@ -44,7 +47,7 @@ func appendFileType(fileTypes []string, c string) ([]string, error) {
 		return fileTypes, ErrBadContentTypeFormat
 	}
 
-	c = strings.Replace(c, `*`, `.+`, -1)
+	c = strings.Replace(regexp.QuoteMeta(c), `\*`, `.+`, -1)
 	for _, f := range fileTypes {
 		if f == c {
 			return fileTypes, nil
@@ -54,10 +57,106 @@ func appendFileType(fileTypes []string, c string) ([]string, error) {
 	return append(fileTypes, c), nil
 }
 
+// parseCoding splits a single element of the "Accept-Encoding" header into a
+// lower cased content coding name and its quality value. Elements with a
+// malformed quality value are given a quality of zero.
+func parseCoding(s string) (string, float64) {
+	params := strings.Split(s, `;`)
+	name, q := strings.ToLower(strings.TrimSpace(params[0])), 1.0
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if len(p) < 2 || (p[0] != 'q' && p[0] != 'Q') || p[1] != '=' {
+			continue
+		}
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil || v < 0 || v > 1 {
+			v = 0
+		}
+		q = v
+	}
+
+	return name, q
+}
+
+// negotiateEncoding returns the supported content encoding that the client
+// prefers the most based on the value of its "Accept-Encoding" header. When
+// several encodings share the highest quality, the first one listed wins. An
+// empty string is returned if none of the supported encodings are acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	return negotiate(acceptEncoding, supportedEncodings)
+}
+
+// negotiate returns the one of encodings that the client prefers the most
+// based on the value of its "Accept-Encoding" header, in the same way as
+// negotiateEncoding.
+func negotiate(acceptEncoding string, encodings []string) string {
+	codings := strings.Split(acceptEncoding, `,`)
+	names, qualities := make([]string, len(codings)), make([]float64, len(codings))
+	listed := make(map[string]bool, len(codings))
+	for i, c := range codings {
+		names[i], qualities[i] = parseCoding(c)
+		listed[names[i]] = true
+	}
+
+	var (
+		encoding string
+		quality  float64
+	)
+	for i, name := range names {
+		if qualities[i] <= quality {
+			continue
+		}
+		if name == `*` {
+			// Wildcard matches any encoding not explicitly listed.
+			for _, e := range encodings {
+				if !listed[e] {
+					encoding, quality = e, qualities[i]
+					break
+				}
+			}
+			continue
+		}
+		for _, e := range encodings {
+			if name == e {
+				encoding, quality = e, qualities[i]
+				break
+			}
+		}
+	}
+
+	return encoding
+}
+
+// acceptsEncoding reports whether the client accepts content encoded with
+// coding, either explicitly or through a wildcard, based on the value of its
+// "Accept-Encoding" header.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	coding, wildcard := strings.ToLower(coding), 0.0
+	for _, c := range strings.Split(acceptEncoding, `,`) {
+		switch name, q := parseCoding(c); name {
+		case coding:
+			return q > 0
+		case `*`:
+			wildcard = q
+		}
+	}
+
+	return wildcard > 0
+}
+
+// compressibleStatus reports whether content of a response with status code
+// can be compressed. Zero stands for an implicit "200 OK". Partial content is
+// never compressed, since its byte ranges refer to the original content.
+func compressibleStatus(code int) bool {
+	return code == 0 || (code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusPartialContent && code != http.StatusNotModified)
+}
+
 // AddContentType adds a new file type to the global list of file types that can
 // be compressed. c should match the form used of a value used in "Content-Type"
 // HTTP header. If c is "*/*", it will reset the list to empty value making it
-// match all types, including no type.
+// match all types, including no type. A "*" in c matches any sequence of
+// characters, while all other characters, such as the "+" of structured syntax
+// suffixes, are matched literally.
 func AddContentType(c ...string) (err error) {
 	// Setup new content type list.
 	cList := compressiableFileTypes
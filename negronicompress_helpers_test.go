@@ -10,8 +10,8 @@ import (
 )
 
 func TestCompileFileTypes(t *testing.T) {
-	if r, err := compileFileTypes(compressiableFileTypes); err != nil || r.String() != `^(text/.+|application/x-javascript|application/xhtml+xml)$` {
-		t.Errorf(`negronimodified.compileFile(%v) = %q, %v; want %q, nil`, compressiableFileTypes, r.String(), err, `^(text/.+|application/x-javascript|application/xhtml+xml)$`)
+	if r, err := compileFileTypes(compressiableFileTypes); err != nil || r.String() != `^(text/.+|application/x-javascript|application/xhtml\+xml)$` {
+		t.Errorf(`negronimodified.compileFile(%v) = %q, %v; want %q, nil`, compressiableFileTypes, r.String(), err, `^(text/.+|application/x-javascript|application/xhtml\+xml)$`)
 	}
 
 	if r, err := compileFileTypes([]string{}); err != nil || r.String() != `.*` {
@@ -66,6 +66,27 @@ func TestAppendFileType(t *testing.T) {
 	compressContentTypeRegEx, _ = compileFileTypes(compressiableFileTypes)
 }
 
+func TestAppendFileType_Literal(t *testing.T) {
+	for _, e := range []struct {
+		pattern, contentType string
+		match                bool
+	}{
+		{`application/xhtml+xml`, `application/xhtml+xml`, true},
+		{`application/xhtml+xml`, `application/xhtmlllxml`, false},
+		{`application/*+json`, `application/vnd.api+json`, true},
+		{`application/*+json`, `application/json`, false},
+		{`application/vnd.ms-excel`, `application/vnd-ms-excel`, false},
+	} {
+		l, err := appendFileType(nil, e.pattern)
+		if err != nil {
+			t.Fatalf(`negronimodified.appendFileType(nil, %q) = %v, %v; want _, nil`, e.pattern, l, err)
+		}
+		if r, _ := compileFileTypes(l); r.MatchString(e.contentType) != e.match {
+			t.Errorf(`negronimodified.compileFileTypes(%q).MatchString(%q) = %v, want %v`, l, e.contentType, !e.match, e.match)
+		}
+	}
+}
+
 func TestAddContentType(t *testing.T) {
 	cLen, cOrig, cExOrig := len(compressiableFileTypes), compressiableFileTypes, *contentTypeRegEx
 	if err := AddContentType(`xyz`); err == nil {
@@ -86,16 +107,62 @@ func TestAddContentType(t *testing.T) {
 	if compressiableFileTypes[cLen] != `application/octet-stream` {
 		t.Errorf(`negronimodified.compressiableFileTypes[%d] = %q, want %q`, cLen, compressiableFileTypes[cLen], `application/octet-stream`)
 	}
-	if r := compressContentTypeRegEx.String(); r != `^(text/.+|application/x-javascript|application/xhtml+xml|application/octet-stream)$` {
-		t.Errorf(`negronimodified.compressContentTypeRegEx.String() = %q, want %q`, r, `^(text/.+|application/x-javascript|application/xhtml+xml|application/octet-stream)$`)
+	if r := compressContentTypeRegEx.String(); r != `^(text/.+|application/x-javascript|application/xhtml\+xml|application/octet-stream)$` {
+		t.Errorf(`negronimodified.compressContentTypeRegEx.String() = %q, want %q`, r, `^(text/.+|application/x-javascript|application/xhtml\+xml|application/octet-stream)$`)
 	}
 
 	contentTypeRegEx = regexp.MustCompile(`.*`)
-	if err := AddContentType(`\x`); err == nil {
-		t.Errorf(`negronimodified.AddContentType(%q) = nil, want err`, `\x`)
+	if err := AddContentType(`\x`); err != nil {
+		t.Errorf(`negronimodified.AddContentType(%q) = %v, want nil`, `\x`, err)
+	}
+	if !compressContentTypeRegEx.MatchString(`\x`) || compressContentTypeRegEx.MatchString(`x`) {
+		t.Errorf(`negronimodified.compressContentTypeRegEx = %q, want it to match %q literally`, compressContentTypeRegEx, `\x`)
 	}
 
 	compressiableFileTypes = cOrig
 	compressContentTypeRegEx, _ = compileFileTypes(compressiableFileTypes)
 	contentTypeRegEx = &cExOrig
 }
+
+func TestParseCoding(t *testing.T) {
+	for _, e := range []struct {
+		in   string
+		name string
+		q    float64
+	}{
+		{`gzip`, `gzip`, 1},
+		{` GZIP `, `gzip`, 1},
+		{`gzip;q=0.5`, `gzip`, .5},
+		{`gzip ; Q=0`, `gzip`, 0},
+		{`gzip;q=abc`, `gzip`, 0},
+		{`gzip;q=2`, `gzip`, 0},
+		{`gzip;level=1`, `gzip`, 1},
+	} {
+		if n, q := parseCoding(e.in); n != e.name || q != e.q {
+			t.Errorf(`negronicompress.parseCoding(%q) = %q, %f; want %q, %f`, e.in, n, q, e.name, e.q)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, e := range [][2]string{
+		{``, ``},
+		{`identity`, ``},
+		{`unknown`, ``},
+		{`gzip`, `gzip`},
+		{`deflate`, `deflate`},
+		{`gzip, deflate`, `gzip`},
+		{`deflate, gzip`, `deflate`},
+		{`deflate;q=0.5, gzip`, `gzip`},
+		{`gzip;q=0, deflate`, `deflate`},
+		{`gzip;q=0`, ``},
+		{`*`, `gzip`},
+		{`gzip;q=0, *`, `deflate`},
+		{`gzip;q=0, deflate;q=0, *`, ``},
+		{`br, *;q=0.1`, `gzip`},
+	} {
+		if enc := negotiateEncoding(e[0]); enc != e[1] {
+			t.Errorf(`negronicompress.negotiateEncoding(%q) = %q, want %q`, e[0], enc, e[1])
+		}
+	}
+}
@@ -5,10 +5,13 @@
 package negronicompress
 
 import (
+	"bytes"
 	"compress/flate"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/codegangsta/negroni"
@@ -34,8 +37,8 @@ func TestCompressResponseWriter_Write(t *testing.T) {
 	}
 	nrw := negroni.NewResponseWriter(rw)
 	crw := &compressResponseWriter{
-		make([]byte, 0),
-		nrw,
+		c:              make([]byte, 0),
+		ResponseWriter: nrw,
 	}
 	if n, err := crw.Write([]byte(`test`)); n != 4 || err != nil {
 		t.Errorf(`negronicompress.compressResponseWriter.Write(%s) = %d, %v; want %d, nil`, []byte(`test`), n, err, 4)
@@ -114,13 +117,16 @@ func TestCompress_AddContentType(t *testing.T) {
 	if handler.compressiableFileTypes[cLen] != `application/octet-stream` {
 		t.Errorf(`negronicompress.compressiableFileTypes[%d] = %q, want %q`, cLen, handler.compressiableFileTypes[cLen], `application/octet-stream`)
 	}
-	if r := handler.compressContentTypeRegEx.String(); r != `^(text/.+|application/x-javascript|application/xhtml+xml|application/octet-stream)$` {
-		t.Errorf(`negronicompress.compressContentTypeRegEx.String() = %q, want %q`, r, `^(text/.+|application/x-javascript|application/xhtml+xml|application/octet-stream)$`)
+	if r := handler.compressContentTypeRegEx.String(); r != `^(text/.+|application/x-javascript|application/xhtml\+xml|application/octet-stream)$` {
+		t.Errorf(`negronicompress.compressContentTypeRegEx.String() = %q, want %q`, r, `^(text/.+|application/x-javascript|application/xhtml\+xml|application/octet-stream)$`)
 	}
 
 	contentTypeRegEx = regexp.MustCompile(`.*`)
-	if err := handler.AddContentType(`\x`); err == nil {
-		t.Errorf(`negronicompress.AddContentType(%q) = nil, want err`, `\x`)
+	if err := handler.AddContentType(`\x`); err != nil {
+		t.Errorf(`negronicompress.AddContentType(%q) = %v, want nil`, `\x`, err)
+	}
+	if !handler.compressContentTypeRegEx.MatchString(`\x`) || handler.compressContentTypeRegEx.MatchString(`x`) {
+		t.Errorf(`negronicompress.compressContentTypeRegEx = %q, want it to match %q literally`, handler.compressContentTypeRegEx, `\x`)
 	}
 	contentTypeRegEx = &cExOrig
 }
@@ -185,11 +191,8 @@ func TestCompress_ServeHTTP(t *testing.T) {
 	w.Body.Reset()
 
 	// Test output content.
-	for _, e := range [2][2]interface{}{
-		{`gzip`, []byte{31, 139, 8, 0, 0, 9, 110, 136, 0, 255, 210, 27, 5, 163, 96, 20, 140, 130, 81, 48, 10, 70, 193, 200, 3, 128, 0, 0, 0, 255, 255, 109, 39, 42, 126, 1, 8, 0, 0}},
-		{`deflate`, []byte{210, 27, 5, 163, 96, 20, 140, 130, 81, 48, 10, 70, 193, 200, 3, 128, 0, 0, 0, 255, 255}},
-	} {
-		req.Header.Set(headerAcceptEncoding, e[0].(string))
+	for _, e := range []string{headerGzip, headerDeflate} {
+		req.Header.Set(headerAcceptEncoding, e)
 		for _, c := range [4][3]string{{cnt[:len(cnt)-2], `text/plain`, `0`}, {cnt[:len(cnt)-2], `application/octet-stream`, `0`}, {cnt, `application/octet-stream`, `0`}, {cnt, `text/plain`, `1`}} {
 			w.Header().Set(headerVary, ``)
 			handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
@@ -201,16 +204,16 @@ func TestCompress_ServeHTTP(t *testing.T) {
 					t.Errorf(`httptest.NewRecorder().Body.String() = %q, want %q`, w.Body.String(), c[0])
 				}
 			} else {
-				b := w.Body.Bytes()
-				if len(b) != len(e[1].([]byte)) {
-					t.Errorf(`httptest.NewRecorder().Body.Bytes() = %v, want %v`, w.Body.Bytes(), e[1].([]byte))
-					continue
+				// Compare decoded content, since compressed bytes depend on the
+				// implementation of the encoder.
+				if h := w.Header().Get(headerContentEncoding); h != e {
+					t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentEncoding, h, e)
 				}
-				for i := range b {
-					if b[i] != e[1].([]byte)[i] {
-						t.Errorf(`httptest.NewRecorder().Body.Bytes() = %v, want %v`, w.Body.Bytes(), e[1].([]byte))
-						break
-					}
+				dec, err := NewDecoder(bytes.NewReader(w.Body.Bytes()), e)
+				if err != nil {
+					t.Errorf(`negronicompress.NewDecoder(%q) = %v, want nil`, e, err)
+				} else if b, err := io.ReadAll(dec); err != nil || string(b) != c[0] {
+					t.Errorf(`decoded httptest.NewRecorder().Body = %q, %v; want %q, nil`, b, err, c[0])
 				}
 			}
 			w.Header().Set(headerContentEncoding, ``)
@@ -218,3 +221,148 @@ func TestCompress_ServeHTTP(t *testing.T) {
 		}
 	}
 }
+
+func TestCompress_Handler(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+
+	for _, h := range []http.Handler{NewCompress().Handler(next), NewMiddleware(flate.BestSpeed)(next)} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if e := w.Header().Get(headerContentEncoding); e != headerGzip {
+			t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentEncoding, e, headerGzip)
+			continue
+		}
+		dec, _ := NewDecoder(w.Body, headerGzip)
+		if b, err := io.ReadAll(dec); err != nil || string(b) != cnt {
+			t.Errorf(`decoded httptest.NewRecorder().Body = %d bytes, %v; want %d bytes, nil`, len(b), err, len(cnt))
+		}
+	}
+}
+
+func TestCompress_ServeHTTPStatus(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	for _, encoding := range []string{headerGzip, ``} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, encoding)
+		w := httptest.NewRecorder()
+		var status int
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(cnt))
+			if nw, ok := w.(negroni.ResponseWriter); ok {
+				status = nw.Status()
+			}
+		})
+
+		// Headers of the recorded result are those actually sent.
+		if ce := w.Result().Header.Get(headerContentEncoding); w.Code != http.StatusCreated || ce != encoding {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with %s %q and status %d = %d, %s %q; want %d, %q`, headerAcceptEncoding, encoding, http.StatusCreated, w.Code, headerContentEncoding, ce, http.StatusCreated, encoding)
+		}
+		if encoding != `` && status != http.StatusCreated {
+			t.Errorf(`negronicompress.compressResponseWriter.Status() = %d, want %d`, status, http.StatusCreated)
+		}
+	}
+}
+
+func TestCompress_ServeHTTPVary(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	for _, encoding := range []string{headerGzip, ``} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, encoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Header().Set(headerVary, `Origin`)
+			w.Write([]byte(cnt))
+		})
+
+		h := w.Result().Header
+		if !headerHasToken(h, headerVary, headerAcceptEncoding) || !headerHasToken(h, headerVary, `Origin`) {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with %s %q and handler set %s sent %q, want it to include %q and %q`, headerAcceptEncoding, encoding, headerVary, h.Values(headerVary), headerAcceptEncoding, `Origin`)
+		}
+	}
+}
+
+func TestCompress_ServeHTTPHeaders(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		status         int
+		header, value  string
+		encoding, sent string
+		skipped        SkipReason
+	}{
+		{http.StatusCreated, headerETag, `"v1"`, headerGzip, `W/"v1"`, ``},
+		{http.StatusOK, headerETag, `W/"v1"`, headerGzip, `W/"v1"`, ``},
+		{http.StatusPartialContent, headerETag, `"v1"`, ``, `"v1"`, SkipStatus},
+		{http.StatusOK, headerCacheControl, `no-transform`, ``, `no-transform`, SkipNoTransform},
+		{http.StatusOK, headerAcceptRanges, `bytes`, headerGzip, ``, ``},
+		{http.StatusPartialContent, headerAcceptRanges, `bytes`, ``, `bytes`, SkipStatus},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Header().Set(e.header, e.value)
+			w.Header().Set(headerVary, `Origin`)
+			w.WriteHeader(e.status)
+			w.Write([]byte(cnt))
+		})
+
+		if w.Code != e.status || res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with status %d and %s %q = status %d, skipped %q; want %d, %q`, e.status, e.header, e.value, w.Code, res.Skipped, e.status, e.skipped)
+		}
+		// Headers of the recorded result are those actually sent.
+		h := w.Result().Header
+		if ce := h.Get(headerContentEncoding); ce != e.encoding {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with status %d and %s %q sent %s %q, want %q`, e.status, e.header, e.value, headerContentEncoding, ce, e.encoding)
+		}
+		if v := h.Get(e.header); v != e.sent {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with status %d and %s %q sent %s %q, want %q`, e.status, e.header, e.value, e.header, v, e.sent)
+		}
+		if !headerHasToken(h, headerVary, headerAcceptEncoding) {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with handler set %s sent %q, want it to include %q`, headerVary, h.Values(headerVary), headerAcceptEncoding)
+		}
+	}
+}
+
+func TestCompress_ServeHTTPSkipWriter(t *testing.T) {
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		accept, encoding string
+	}{
+		{``, ``},
+		{headerGzip, headerGzip},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		rw := negroni.NewResponseWriter(httptest.NewRecorder())
+		rw.Header().Set(headerContentEncoding, e.encoding)
+		handler.ServeHTTP(rw, req, func(w http.ResponseWriter, r *http.Request) {
+			if w != rw {
+				t.Errorf(`negronicompress.compress.ServeHTTP() with %s %q and %s %q passed %T to the handler, want the original writer`, headerAcceptEncoding, e.accept, headerContentEncoding, e.encoding, w)
+			}
+			w.Header().Set(headerVary, `Origin`)
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		if rw.Status() != http.StatusAccepted || !headerHasToken(rw.Header(), headerVary, headerAcceptEncoding) {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with %s %q and %s %q = status %d, %s %q; want %d, %q`, headerAcceptEncoding, e.accept, headerContentEncoding, e.encoding, rw.Status(), headerVary, rw.Header().Values(headerVary), http.StatusAccepted, headerAcceptEncoding)
+		}
+	}
+}
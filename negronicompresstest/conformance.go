@@ -0,0 +1,251 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompresstest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// errConformancePanic is the value handlers of the conformance suite panic
+// with.
+var errConformancePanic = errors.New(`negronicompresstest: conformance panic`)
+
+// Conformance values exercised by the suite.
+var (
+	conformanceStatuses = []int{
+		http.StatusOK,
+		http.StatusCreated,
+		http.StatusNoContent,
+		http.StatusPartialContent,
+		http.StatusNotModified,
+		http.StatusNotFound,
+		http.StatusInternalServerError,
+	}
+	conformanceMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	conformanceAccepts = []string{``, `identity`, `gzip`, `deflate`, `gzip;q=0, deflate`, `*`, `*;q=0`, `br`}
+	// conformancePresets are headers set by the handler before the middleware
+	// gets to see the response.
+	conformancePresets = []string{``, `Content-Length`, `ETag`, `Vary`, `Cache-Control`, `Content-Encoding`, `Accept-Ranges`}
+	// conformanceModes are the ways the handler writes its response.
+	conformanceModes = []string{`implicit`, `header`, `flush`, `panic`}
+)
+
+// conformanceCase is a single handler setup of the conformance suite.
+type conformanceCase struct {
+	status int
+	method string
+	preset string
+	mode   string
+}
+
+// String returns the name of the subtest running c.
+func (c conformanceCase) String() string {
+	preset := c.preset
+	if preset == `` {
+		preset = `none`
+	}
+
+	return fmt.Sprintf(`%s/%d/%s/%s`, c.method, c.status, preset, c.mode)
+}
+
+// Conformance runs a suite of tests checking that responses of handlers wrapped
+// by mw follow HTTP semantics. It exercises a matrix of status codes, request
+// methods, "Accept-Encoding" headers, headers set in advance by the handler,
+// flushes and handler panics. mw is usually the Handler method of a middleware
+// instance configured the same way as in production, but can be any wrapper
+// around it.
+func Conformance(t *testing.T, mw func(http.Handler) http.Handler) {
+	content := []byte(strings.Repeat(`Conformance suite content. `, 400))
+	var encoded bytes.Buffer
+	gw := gzip.NewWriter(&encoded)
+	gw.Write(content)
+	gw.Close()
+
+	for _, status := range conformanceStatuses {
+		for _, method := range conformanceMethods {
+			for _, preset := range conformancePresets {
+				for _, mode := range conformanceModes {
+					if mode == `implicit` && status != http.StatusOK {
+						continue
+					}
+					c := conformanceCase{status, method, preset, mode}
+					t.Run(c.String(), func(t *testing.T) {
+						h := mw(conformanceHandler(c, content, encoded.Bytes()))
+						for _, accept := range conformanceAccepts {
+							checkConformance(t, h, c, accept, content)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// conformanceHandler returns a handler responding according to c. Content is
+// sent as is, or as encoded if the handler is to set "Content-Encoding".
+func conformanceHandler(c conformanceCase, content, encoded []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := content
+		w.Header().Set(`Content-Type`, `text/plain; charset=utf-8`)
+		switch c.preset {
+		case `Content-Encoding`:
+			body = encoded
+			w.Header().Set(`Content-Encoding`, `gzip`)
+		case `ETag`:
+			w.Header().Set(`ETag`, `"v1"`)
+		case `Vary`:
+			w.Header().Set(`Vary`, `Origin`)
+		case `Cache-Control`:
+			w.Header().Set(`Cache-Control`, `public, no-transform`)
+		case `Accept-Ranges`:
+			w.Header().Set(`Accept-Ranges`, `bytes`)
+		}
+		if c.preset == `Content-Length` && bodyAllowed(c.status) {
+			w.Header().Set(`Content-Length`, strconv.Itoa(len(body)))
+		}
+		if c.status == http.StatusPartialContent {
+			w.Header().Set(`Content-Range`, fmt.Sprintf(`bytes 0-%d/%d`, len(body)-1, 2*len(body)))
+		}
+		if !bodyAllowed(c.status) {
+			body = nil
+		}
+
+		if c.mode != `implicit` {
+			w.WriteHeader(c.status)
+		}
+		switch c.mode {
+		case `flush`:
+			w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			w.Write(body[len(body)/2:])
+		case `panic`:
+			w.Write(body[:len(body)/2])
+			panic(errConformancePanic)
+		default:
+			w.Write(body)
+		}
+	})
+}
+
+// checkConformance serves a request described by c with h for a client sending
+// accept and checks the response.
+func checkConformance(t *testing.T, h http.Handler, c conformanceCase, accept string, content []byte) {
+	t.Helper()
+
+	r := httptest.NewRequest(c.method, `/`, nil)
+	if accept != `` {
+		r.Header.Set(`Accept-Encoding`, accept)
+	}
+	rec := NewRecorder()
+
+	var recovered any
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		h.ServeHTTP(rec, r)
+	}()
+
+	if c.mode == `panic` {
+		if recovered != errConformancePanic {
+			t.Errorf(`Accept-Encoding %q: recovered %v, want handler panic to propagate`, accept, recovered)
+		}
+		// Nothing sent yet means a recovery handler can still respond, so no
+		// headers describing the lost content may be left behind.
+		if !rec.wroteHeader {
+			if e := rec.Header().Get(`Content-Encoding`); e != `` && c.preset != `Content-Encoding` {
+				t.Errorf(`Accept-Encoding %q: Content-Encoding %q left set after panic`, accept, e)
+			}
+		}
+		return
+	} else if recovered != nil {
+		panic(recovered)
+	}
+
+	for _, v := range rec.Violations() {
+		t.Errorf(`Accept-Encoding %q: %s`, accept, v)
+	}
+
+	resp := rec.Result()
+	if resp.StatusCode != c.status {
+		t.Errorf(`Accept-Encoding %q: status = %d, want %d`, accept, resp.StatusCode, c.status)
+	}
+	if !hasToken(resp.Header.Values(`Vary`), `Accept-Encoding`) {
+		t.Errorf(`Accept-Encoding %q: Vary = %q, want it to include %q`, accept, resp.Header.Values(`Vary`), `Accept-Encoding`)
+	}
+	if c.preset == `Vary` && !hasToken(resp.Header.Values(`Vary`), `Origin`) {
+		t.Errorf(`Accept-Encoding %q: Vary = %q, want it to keep %q`, accept, resp.Header.Values(`Vary`), `Origin`)
+	}
+
+	preset := ``
+	if c.preset == `Content-Encoding` {
+		preset = `gzip`
+	}
+	e := resp.Header.Get(`Content-Encoding`)
+	switch {
+	case e == preset:
+	case !bodyAllowed(c.status) || c.status == http.StatusPartialContent:
+		t.Errorf(`Accept-Encoding %q: Content-Encoding = %q for status %d, want %q`, accept, e, c.status, preset)
+	case c.preset == `Cache-Control`:
+		t.Errorf(`Accept-Encoding %q: Content-Encoding = %q despite no-transform, want %q`, accept, e, preset)
+	case !accepts(accept, e):
+		t.Errorf(`Accept-Encoding %q: Content-Encoding = %q, which the client does not accept`, accept, e)
+	}
+	if c.preset == `ETag` && e != `` && resp.Header.Get(`ETag`) == `"v1"` {
+		t.Errorf(`Accept-Encoding %q: strong ETag %q kept for %s encoded content`, accept, `"v1"`, e)
+	}
+	if c.preset == `Accept-Ranges` && e != `` && resp.Header.Get(`Accept-Ranges`) != `` {
+		t.Errorf(`Accept-Encoding %q: Accept-Ranges %q kept for content encoded on the fly`, accept, resp.Header.Get(`Accept-Ranges`))
+	}
+	if c.status == http.StatusPartialContent && resp.Header.Get(`Content-Range`) == `` {
+		t.Errorf(`Accept-Encoding %q: Content-Range removed`, accept)
+	}
+
+	if !bodyAllowed(c.status) {
+		return
+	}
+	b, err := Decode(rec.Body.Bytes(), e)
+	if err != nil {
+		t.Errorf(`Accept-Encoding %q: decoding %q content = %v, want nil`, accept, e, err)
+	} else if !bytes.Equal(b, content) {
+		t.Errorf(`Accept-Encoding %q: decoded %q content = %d bytes, want %d`, accept, e, len(b), len(content))
+	}
+}
+
+// accepts reports whether a client sending acceptEncoding accepts content
+// encoded with coding. Empty coding stands for identity, which is always
+// accepted.
+func accepts(acceptEncoding, coding string) bool {
+	if coding == `` {
+		return true
+	}
+
+	wildcard := false
+	for _, c := range strings.Split(acceptEncoding, `,`) {
+		params := strings.Split(c, `;`)
+		name, q := strings.TrimSpace(params[0]), 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), `=`); ok && strings.EqualFold(k, `q`) {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			return q > 0
+		case name == `*`:
+			wildcard = q > 0
+		}
+	}
+
+	return wildcard
+}
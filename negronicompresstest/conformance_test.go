@@ -0,0 +1,51 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompresstest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+func TestConformance(t *testing.T) {
+	for _, e := range []struct {
+		name string
+		mw   func(http.Handler) http.Handler
+	}{
+		{`default`, negronicompress.NewCompress().Handler},
+		{`budget`, func() func(http.Handler) http.Handler {
+			m := negronicompress.NewCompress()
+			m.SetBudget(negronicompress.NewBudget(4096, 1))
+			return m.Handler
+		}()},
+		{`spill`, func() func(http.Handler) http.Handler {
+			m := negronicompress.NewCompress()
+			m.SetSpill(1024, t.TempDir())
+			return m.Handler
+		}()},
+		{`parallel`, func() func(http.Handler) http.Handler {
+			m := negronicompress.NewCompress()
+			m.SetParallel(1024, 1024, 2)
+			return m.Handler
+		}()},
+		{`transcode`, func() func(http.Handler) http.Handler {
+			m := negronicompress.NewCompress()
+			m.SetTranscode(1 << 20)
+			return m.Handler
+		}()},
+		{`explain`, func() func(http.Handler) http.Handler {
+			m := negronicompress.NewCompress()
+			m.SetExplainFunc(func(*http.Request) bool { return true })
+			m.SetMinSavings(.5, 1024)
+			return m.Handler
+		}()},
+	} {
+		t.Run(e.name, func(t *testing.T) {
+			Conformance(t, e.mw)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package negronicompresstest provides utilities for testing handlers behind
+// the compress middleware and the middleware itself.
+package negronicompresstest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+// Encodings returns a list of values of the "Accept-Encoding" header covering
+// identity and every encoding registered with the middleware.
+func Encodings() []string {
+	return append([]string{`identity`}, negronicompress.Encodings()...)
+}
+
+// Do serves a request with the given method and target with h and returns the
+// recorded response. acceptEncoding is sent in the "Accept-Encoding" header,
+// unless it is empty.
+func Do(h http.Handler, method, target, acceptEncoding string) *Recorder {
+	r := httptest.NewRequest(method, target, nil)
+	if acceptEncoding != `` {
+		r.Header.Set(`Accept-Encoding`, acceptEncoding)
+	}
+
+	rec := NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// ForEachEncoding runs f as a subtest for each value returned by Encodings.
+func ForEachEncoding(t *testing.T, f func(t *testing.T, acceptEncoding string)) {
+	t.Helper()
+	for _, e := range Encodings() {
+		t.Run(e, func(t *testing.T) {
+			f(t, e)
+		})
+	}
+}
+
+// Decode returns body decoded from encoding, which can be any encoding
+// registered with the middleware. Empty and "identity" encodings return body
+// as is.
+func Decode(body []byte, encoding string) ([]byte, error) {
+	if encoding == `` || strings.EqualFold(encoding, `identity`) {
+		return body, nil
+	}
+
+	dec, err := negronicompress.NewDecoder(bytes.NewReader(body), encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	return io.ReadAll(dec)
+}
+
+// CheckResponse verifies that resp is encoded with encoding, empty meaning not
+// encoded at all, that its "Vary" header names "Accept-Encoding" and that its
+// "Content-Length", if any, matches the size of its body. It returns the
+// decoded body.
+func CheckResponse(t testing.TB, resp *http.Response, encoding string) []byte {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Errorf(`reading response body = %v, want nil`, err)
+		return nil
+	}
+
+	if e := resp.Header.Get(`Content-Encoding`); !strings.EqualFold(e, encoding) {
+		t.Errorf(`response Content-Encoding = %q, want %q`, e, encoding)
+	}
+	if !hasToken(resp.Header.Values(`Vary`), `Accept-Encoding`) {
+		t.Errorf(`response Vary = %q, want it to include %q`, resp.Header.Values(`Vary`), `Accept-Encoding`)
+	}
+	if l := resp.Header.Get(`Content-Length`); l != `` {
+		if n, err := strconv.Atoi(l); err != nil || n != len(body) {
+			t.Errorf(`response Content-Length = %q, want %d`, l, len(body))
+		}
+	}
+
+	decoded, err := Decode(body, resp.Header.Get(`Content-Encoding`))
+	if err != nil {
+		t.Errorf(`decoding response body = %v, want nil`, err)
+	}
+	return decoded
+}
+
+// AssertBody verifies resp with CheckResponse and compares its decoded body
+// with want.
+func AssertBody(t testing.TB, resp *http.Response, encoding string, want []byte) {
+	t.Helper()
+
+	if b := CheckResponse(t, resp, encoding); !bytes.Equal(b, want) {
+		t.Errorf(`decoded response body = %d bytes %q, want %d bytes %q`, len(b), abbreviate(b), len(want), abbreviate(want))
+	}
+}
+
+// hasToken reports whether any of the comma separated header values contains
+// token.
+func hasToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, `,`) {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// abbreviate shortens b for error messages.
+func abbreviate(b []byte) string {
+	if len(b) > 64 {
+		return string(b[:64]) + `...`
+	}
+
+	return string(b)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompresstest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mocheryl/negroni-compress"
+)
+
+func TestForEachEncoding(t *testing.T) {
+	cnt := []byte(strings.Repeat(`content `, 1000))
+	h := negronicompress.NewCompress().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `text/plain`)
+		w.Write(cnt)
+	}))
+
+	var seen []string
+	ForEachEncoding(t, func(t *testing.T, acceptEncoding string) {
+		seen = append(seen, acceptEncoding)
+		rec := Do(h, `GET`, `/`, acceptEncoding)
+		rec.Check(t)
+
+		encoding := acceptEncoding
+		if encoding == `identity` {
+			encoding = ``
+		}
+		AssertBody(t, rec.Result(), encoding, cnt)
+	})
+	if len(seen) != len(negronicompress.Encodings())+1 {
+		t.Errorf(`negronicompresstest.ForEachEncoding() ran for %q, want identity and %q`, seen, negronicompress.Encodings())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if b, err := Decode([]byte(`plain`), `identity`); err != nil || string(b) != `plain` {
+		t.Errorf(`negronicompresstest.Decode("identity") = %q, %v; want %q, nil`, b, err, `plain`)
+	}
+	if _, err := Decode([]byte(`plain`), `gzip`); err == nil {
+		t.Error(`negronicompresstest.Decode("gzip") of plain content = nil, want err`)
+	}
+	if _, err := Decode([]byte(`plain`), `unknown`); err == nil {
+		t.Error(`negronicompresstest.Decode("unknown") = nil, want err`)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	for _, e := range []struct {
+		name       string
+		f          func(w http.ResponseWriter)
+		violations int
+	}{
+		{`valid`, func(w http.ResponseWriter) {
+			w.Header().Set(`Content-Length`, `2`)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`ok`))
+		}, 0},
+		{`superfluous WriteHeader`, func(w http.ResponseWriter) {
+			w.Write([]byte(`ok`))
+			w.WriteHeader(http.StatusInternalServerError)
+		}, 1},
+		{`header after write`, func(w http.ResponseWriter) {
+			w.Write([]byte(`ok`))
+			w.Header().Set(`Content-Encoding`, `gzip`)
+		}, 1},
+		{`body with no content`, func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNoContent)
+			w.Write([]byte(`ok`))
+		}, 1},
+		{`content length mismatch`, func(w http.ResponseWriter) {
+			w.Header().Set(`Content-Length`, `10`)
+			w.Write([]byte(`ok`))
+		}, 1},
+		{`invalid status`, func(w http.ResponseWriter) {
+			w.WriteHeader(1000)
+		}, 1},
+	} {
+		rec := NewRecorder()
+		e.f(rec)
+		if v := rec.Violations(); len(v) != e.violations {
+			t.Errorf(`negronicompresstest.Recorder.Violations() for %s = %q, want %d violations`, e.name, v, e.violations)
+		}
+	}
+}
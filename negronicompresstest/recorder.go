@@ -0,0 +1,110 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompresstest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Recorder is an httptest.ResponseRecorder that also records violations of
+// HTTP invariants that a real server would silently paper over, such as
+// headers changed after they were sent.
+type Recorder struct {
+	*httptest.ResponseRecorder
+
+	wroteHeader bool
+	violations  []string
+}
+
+// NewRecorder returns an initialized Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (r *Recorder) WriteHeader(code int) {
+	switch {
+	case code < 100 || code > 999:
+		r.violate(`invalid status code %d`, code)
+		return
+	case r.wroteHeader:
+		r.violate(`superfluous WriteHeader(%d) after status %d was sent`, code, r.Code)
+		return
+	case code >= 200 || code == http.StatusSwitchingProtocols:
+		r.wroteHeader = true
+	}
+
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (r *Recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if len(b) > 0 && !bodyAllowed(r.Code) {
+		r.violate(`body written for status %d`, r.Code)
+	}
+
+	return r.ResponseRecorder.Write(b)
+}
+
+// WriteString implements io.StringWriter.
+func (r *Recorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+// Violations returns a list of all HTTP invariants violated so far.
+func (r *Recorder) Violations() []string {
+	v := append([]string(nil), r.violations...)
+	if r.wroteHeader {
+		// Headers of the result are a snapshot taken when they were sent.
+		sent, header := r.Result().Header, r.Header()
+		for k, values := range header {
+			if strings.HasPrefix(k, http.TrailerPrefix) || k == `Trailer` {
+				continue
+			}
+			if !reflect.DeepEqual(sent[k], values) {
+				v = append(v, fmt.Sprintf(`header %s changed to %q after it was sent as %q`, k, values, sent[k]))
+			}
+		}
+		for k, values := range sent {
+			if _, ok := header[k]; !ok {
+				v = append(v, fmt.Sprintf(`header %s removed after it was sent as %q`, k, values))
+			}
+		}
+	}
+	if l := r.Result().Header.Get(`Content-Length`); l != `` && bodyAllowed(r.Code) {
+		if n, err := strconv.Atoi(l); err != nil || n != r.Body.Len() {
+			v = append(v, fmt.Sprintf(`Content-Length %q does not match body of %d bytes`, l, r.Body.Len()))
+		}
+	}
+
+	return v
+}
+
+// Check reports every violated HTTP invariant as an error of t.
+func (r *Recorder) Check(t testing.TB) {
+	t.Helper()
+	for _, v := range r.Violations() {
+		t.Error(v)
+	}
+}
+
+// violate records a violated HTTP invariant.
+func (r *Recorder) violate(format string, a ...any) {
+	r.violations = append(r.violations, fmt.Sprintf(format, a...))
+}
+
+// bodyAllowed reports whether a response with status code may have a body.
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Observer is notified about the decisions the middleware makes while handling
+// a response. It can be used to emit logs or tracing spans without changing
+// the middleware itself. Methods are called from the goroutine serving the
+// request and should return quickly.
+type Observer interface {
+	// OnNegotiated is called when a content encoding acceptable to the client
+	// is found for request r.
+	OnNegotiated(r *http.Request, encoding string)
+	// OnSkipped is called when the response to r is sent without compression.
+	OnSkipped(r *http.Request, reason SkipReason)
+	// OnCompressed is called after the response to r was compressed with
+	// encoding from inSize to outSize bytes in time d.
+	OnCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration)
+	// OnError is called when compressing or sending the response to r fails.
+	OnError(r *http.Request, err error)
+}
+
+// nopObserver is an Observer that ignores all notifications.
+type nopObserver struct{}
+
+func (nopObserver) OnNegotiated(*http.Request, string)                          {}
+func (nopObserver) OnSkipped(*http.Request, SkipReason)                         {}
+func (nopObserver) OnCompressed(*http.Request, string, int, int, time.Duration) {}
+func (nopObserver) OnError(*http.Request, error)                                {}
+
+// slogObserver is an Observer that writes notifications to a structured
+// logger.
+type slogObserver struct {
+	l *slog.Logger
+}
+
+// NewSlogObserver returns an Observer that logs compression decisions to l.
+// Negotiation, skipping and compression are logged at debug level while errors
+// are logged at error level.
+func NewSlogObserver(l *slog.Logger) Observer {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogObserver{l}
+}
+
+func (o *slogObserver) OnNegotiated(r *http.Request, encoding string) {
+	o.l.DebugContext(r.Context(), `compression negotiated`, slog.String(`path`, r.URL.Path), slog.String(`encoding`, encoding))
+}
+
+func (o *slogObserver) OnSkipped(r *http.Request, reason SkipReason) {
+	o.l.DebugContext(r.Context(), `compression skipped`, slog.String(`path`, r.URL.Path), slog.String(`reason`, string(reason)))
+}
+
+func (o *slogObserver) OnCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration) {
+	o.l.DebugContext(r.Context(), `response compressed`, slog.String(`path`, r.URL.Path), slog.String(`encoding`, encoding), slog.Int(`in`, inSize), slog.Int(`out`, outSize), slog.Duration(`duration`, d))
+}
+
+func (o *slogObserver) OnError(r *http.Request, err error) {
+	o.l.ErrorContext(r.Context(), `compression failed`, slog.String(`path`, r.URL.Path), slog.Any(`error`, err))
+}
+
+// Result describes how the middleware handled a single response.
+type Result struct {
+	// Negotiated is the content encoding chosen for the client. It is known
+	// before the rest of the chain is called, so handlers further down can
+	// inspect it as well.
+	Negotiated string
+	// Encoding is the content encoding used for the response or empty if the
+	// response was not compressed.
+	Encoding string
+	// Skipped is the reason why the response was not compressed.
+	Skipped SkipReason
+	// InSize is the size of the response content before compression.
+	InSize int
+	// OutSize is the size of the response content after compression.
+	OutSize int
+	// Duration is the time spent compressing the response content.
+	Duration time.Duration
+	// Decoded is the content encoding the original content was decoded from
+	// to transcode it, or empty if it was not transcoded.
+	Decoded string
+
+	// level is the compression level requested with SetRequestLevel.
+	level int
+	// hasLevel is set when level was requested.
+	hasLevel bool
+	// constrained is set when the client is on a slow or metered connection.
+	constrained bool
+}
+
+// Ratio returns the compressed size divided by the original size or zero if
+// the response was not compressed.
+func (r *Result) Ratio() float64 {
+	if r.InSize == 0 {
+		return 0
+	}
+	return float64(r.OutSize) / float64(r.InSize)
+}
+
+// resultKey is the context key under which a *Result is stored.
+type resultKey struct{}
+
+// NewResultContext returns a copy of ctx carrying an empty Result that the
+// middleware fills in while handling the request. Middleware placed in front
+// of this one, such as a request logger, can use it to read the outcome after
+// the rest of the chain has returned.
+func NewResultContext(ctx context.Context) (context.Context, *Result) {
+	res := new(Result)
+	return context.WithValue(ctx, resultKey{}, res), res
+}
+
+// ResultFromContext returns the Result stored in ctx, if any.
+func ResultFromContext(ctx context.Context) (*Result, bool) {
+	res, ok := ctx.Value(resultKey{}).(*Result)
+	return res, ok
+}
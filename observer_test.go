@@ -0,0 +1,137 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type observerTest struct {
+	events []string
+}
+
+func (o *observerTest) OnNegotiated(r *http.Request, encoding string) {
+	o.events = append(o.events, `negotiated:`+encoding)
+}
+
+func (o *observerTest) OnSkipped(r *http.Request, reason SkipReason) {
+	o.events = append(o.events, `skipped:`+string(reason))
+}
+
+func (o *observerTest) OnCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration) {
+	o.events = append(o.events, `compressed:`+encoding)
+}
+
+func (o *observerTest) OnError(r *http.Request, err error) {
+	o.events = append(o.events, `error`)
+}
+
+func TestCompress_SetObserver(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	o := &observerTest{}
+	handler := NewCompress()
+	handler.SetObserver(o)
+
+	for _, e := range []struct {
+		accept, body string
+		events       []string
+	}{
+		{``, cnt, []string{`skipped:not-accepted`}},
+		{headerGzip, `.`, []string{`negotiated:gzip`, `skipped:min-size`}},
+		{headerDeflate, cnt, []string{`negotiated:deflate`, `compressed:deflate`}},
+	} {
+		o.events = nil
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		handler.ServeHTTP(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Write([]byte(e.body))
+		})
+		if strings.Join(o.events, ` `) != strings.Join(e.events, ` `) {
+			t.Errorf(`negronicompress.Observer events for %q = %v, want %v`, e.accept, o.events, e.events)
+		}
+	}
+
+	// Invalid compression level is reported and content is sent unchanged.
+	o.events = nil
+	handler.compressionLevel = 100
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	if strings.Join(o.events, ` `) != `negotiated:gzip error skipped:error` {
+		t.Errorf(`negronicompress.Observer events = %v, want %v`, o.events, []string{`negotiated:gzip`, `error`, `skipped:error`})
+	}
+	if w.Body.String() != cnt || w.Header().Get(headerContentEncoding) != `` {
+		t.Errorf(`httptest.NewRecorder().Body.String() = %q, want %q`, w.Body.String(), cnt)
+	}
+
+	handler.SetObserver(nil)
+	if _, ok := handler.observer.(nopObserver); !ok {
+		t.Errorf(`negronicompress.compress.SetObserver(nil) observer = %T, want %T`, handler.observer, nopObserver{})
+	}
+}
+
+func TestNewSlogObserver(t *testing.T) {
+	var b bytes.Buffer
+	o := NewSlogObserver(slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+
+	o.OnNegotiated(req, headerGzip)
+	o.OnSkipped(req, SkipMinSize)
+	o.OnCompressed(req, headerGzip, 100, 10, time.Millisecond)
+	o.OnError(req, errors.New(`test`))
+	for _, e := range []string{`encoding=gzip`, `reason=min-size`, `in=100 out=10`, `level=ERROR`, `error=test`, `path=/foo`} {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf(`negronicompress.NewSlogObserver() output does not contain %q`, e)
+		}
+	}
+
+	if NewSlogObserver(nil) == nil {
+		t.Error(`negronicompress.NewSlogObserver(nil) cannot return nil`)
+	}
+}
+
+func TestResultFromContext(t *testing.T) {
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	if _, ok := ResultFromContext(req.Context()); ok {
+		t.Fatal(`negronicompress.ResultFromContext() = _, true; want _, false`)
+	}
+
+	ctx, res := NewResultContext(req.Context())
+	var negotiated string
+	NewCompress().ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+		if res, ok := ResultFromContext(r.Context()); ok {
+			negotiated = res.Negotiated
+		}
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	if negotiated != headerGzip {
+		t.Errorf(`negronicompress.Result.Negotiated = %q, want %q`, negotiated, headerGzip)
+	}
+	if res.Encoding != headerGzip || res.InSize != len(cnt) || res.OutSize == 0 || res.Skipped != `` {
+		t.Errorf(`negronicompress.Result = %+v, want gzip encoded result`, *res)
+	}
+	if r := res.Ratio(); r <= 0 || r >= 1 {
+		t.Errorf(`negronicompress.Result.Ratio() = %f, want between 0 and 1`, r)
+	}
+
+	if r := (&Result{}).Ratio(); r != 0 {
+		t.Errorf(`negronicompress.Result{}.Ratio() = %f, want %f`, r, 0.)
+	}
+}
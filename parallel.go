@@ -0,0 +1,214 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// parallelBlockSize is the default size of blocks compressed in parallel.
+	parallelBlockSize int = 128 * 1024
+	// dictionarySize is the size of the deflate sliding window. Each block is
+	// compressed with this many trailing bytes of the previous block as its
+	// dictionary so that compression ratio does not suffer from splitting.
+	dictionarySize int = 32 * 1024
+)
+
+// gzipHeader is a minimal gzip member header without modification time, extra
+// flags and with an unknown operating system.
+var gzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+
+// SetParallel enables parallel compression of content of at least threshold
+// bytes. Such content is split into blocks of blockSize bytes that are
+// compressed on up to workers goroutines at the same time and joined into a
+// single valid stream. Zero threshold disables parallel compression, while
+// zero blockSize or workers select a block size of 128 KiB and one worker per
+// CPU respectively. Only "gzip" and "deflate" encodings are compressed in
+// parallel; others always use a single writer.
+func (h *compress) SetParallel(threshold int64, blockSize, workers int) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	if blockSize <= 0 {
+		blockSize = parallelBlockSize
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	h.parallelThreshold, h.parallelBlockSize, h.parallelWorkers = threshold, blockSize, workers
+}
+
+// useParallel reports whether n bytes of content should be compressed with
+// encoding in parallel.
+func (h *compress) useParallel(encoding string, n int64) bool {
+	return h.parallelThreshold > 0 && n >= h.parallelThreshold && (encoding == headerGzip || encoding == headerDeflate)
+}
+
+// parallelBlock is a single block of content compressed in parallel.
+type parallelBlock struct {
+	data []byte
+	dict []byte
+	last bool
+	out  bytes.Buffer
+	err  error
+	// done is closed once the block is compressed.
+	done chan struct{}
+}
+
+// compress compresses the block as a part of a raw deflate stream. Blocks other
+// than the last one end with a sync flush so that they are byte aligned and
+// can be concatenated.
+func (b *parallelBlock) compress(level int) {
+	defer close(b.done)
+
+	fw, err := flate.NewWriterDict(&b.out, level, b.dict)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if _, b.err = fw.Write(b.data); b.err != nil {
+		return
+	}
+	if b.last {
+		b.err = fw.Close()
+	} else {
+		b.err = fw.Flush()
+	}
+}
+
+// compressParallel writes n bytes read from src to w encoded with encoding at
+// the given compression level. Content is compressed in blocks of blockSize
+// bytes by a pool of workers goroutines and written out in order as soon as
+// each block and all blocks before it are done, so at most twice as many
+// blocks as workers are held in memory. It stops with the error of ctx before
+// reading the next block once ctx is done.
+func compressParallel(ctx context.Context, w io.Writer, encoding string, level int, src io.Reader, n int64, blockSize, workers int) error {
+	if encoding == headerGzip {
+		if _, err := w.Write(gzipHeader); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		jobs    = make(chan *parallelBlock, workers)
+		ordered = make(chan *parallelBlock, 2*workers)
+		buffers = make(chan []byte, 2*workers)
+		written = make(chan struct{})
+		wg      sync.WaitGroup
+		werr    error
+	)
+	for i := 0; i < cap(buffers); i++ {
+		buffers <- nil
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				b.compress(level)
+			}
+		}()
+	}
+	go func() {
+		defer close(written)
+		for b := range ordered {
+			<-b.done
+			if werr == nil {
+				if werr = b.err; werr == nil {
+					_, werr = w.Write(b.out.Bytes())
+				}
+				if werr != nil {
+					// Stop reading, the remaining blocks are only drained.
+					cancel()
+				}
+			}
+			buffers <- b.data[:0]
+		}
+	}()
+
+	var (
+		err       error
+		crc       uint32
+		dict      []byte
+		remaining = n
+	)
+	for done := false; !done; {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var buf []byte
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case buf = <-buffers:
+		}
+		if err != nil {
+			break
+		}
+
+		size := int64(blockSize)
+		if remaining <= size {
+			size, done = remaining, true
+		}
+		if buf == nil {
+			buf = make([]byte, blockSize)
+		}
+		data := buf[:size]
+		if _, err = io.ReadFull(src, data); err != nil {
+			break
+		}
+		remaining -= size
+		crc = crc32.Update(crc, crc32.IEEETable, data)
+
+		b := &parallelBlock{data: data, dict: dict, last: done, done: make(chan struct{})}
+		ordered <- b
+		jobs <- b
+
+		// Buffers are reused once their block is written, so the dictionary
+		// of the next block is always a copy.
+		if len(data) >= dictionarySize {
+			dict = append(make([]byte, 0, dictionarySize), data[len(data)-dictionarySize:]...)
+		} else {
+			// Small blocks only fill a part of the window.
+			if k := len(dict) + len(data) - dictionarySize; k > 0 {
+				dict = dict[k:]
+			}
+			dict = append(append(make([]byte, 0, dictionarySize), dict...), data...)
+		}
+	}
+	close(jobs)
+	close(ordered)
+	wg.Wait()
+	<-written
+	if werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+
+	if encoding == headerGzip {
+		trailer := make([]byte, 8)
+		binary.LittleEndian.PutUint32(trailer[:4], crc)
+		binary.LittleEndian.PutUint32(trailer[4:], uint32(n))
+		if _, err := w.Write(trailer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompressParallel(t *testing.T) {
+	text := []byte(strings.Repeat(`The quick brown fox jumps over the lazy dog. `, 20000))
+	random := make([]byte, 300000)
+	rand.NewChaCha8([32]byte{3}).Read(random)
+
+	for _, e := range []struct {
+		content   []byte
+		blockSize int
+		workers   int
+	}{
+		{nil, parallelBlockSize, 4},
+		{text[:100], parallelBlockSize, 4},
+		{text, parallelBlockSize, 4},
+		{text[:50000], 1000, 3},
+		{text, 50000, 1},
+		{random, 100000, 2},
+		{text[:parallelBlockSize*2], parallelBlockSize, 2},
+		{text, 4096, 8},
+	} {
+		var gz, fl bytes.Buffer
+		if err := compressParallel(context.Background(), &gz, headerGzip, flate.DefaultCompression, bytes.NewReader(e.content), int64(len(e.content)), e.blockSize, e.workers); err != nil {
+			t.Fatalf(`negronicompress.compressParallel(gzip) = %v, want nil`, err)
+		}
+		zr, err := gzip.NewReader(&gz)
+		if err != nil {
+			t.Fatalf(`gzip.NewReader() = _, %v; want _, nil`, err)
+		}
+		if b, err := io.ReadAll(zr); err != nil || !bytes.Equal(b, e.content) {
+			t.Errorf(`gzip decoded negronicompress.compressParallel() output of %d bytes with block size %d = %d bytes, %v; want original content, nil`, len(e.content), e.blockSize, len(b), err)
+		}
+
+		if err := compressParallel(context.Background(), &fl, headerDeflate, flate.BestSpeed, bytes.NewReader(e.content), int64(len(e.content)), e.blockSize, e.workers); err != nil {
+			t.Fatalf(`negronicompress.compressParallel(deflate) = %v, want nil`, err)
+		}
+		if b, err := io.ReadAll(flate.NewReader(&fl)); err != nil || !bytes.Equal(b, e.content) {
+			t.Errorf(`flate decoded negronicompress.compressParallel() output of %d bytes with block size %d = %d bytes, %v; want original content, nil`, len(e.content), e.blockSize, len(b), err)
+		}
+	}
+
+	// Dictionary keeps ratio close to single writer compression.
+	var single, parallel bytes.Buffer
+	encode(&single, headerGzip, flate.DefaultCompression, text)
+	compressParallel(context.Background(), &parallel, headerGzip, flate.DefaultCompression, bytes.NewReader(text), int64(len(text)), parallelBlockSize, 4)
+	if parallel.Len() > single.Len()*2 {
+		t.Errorf(`len(negronicompress.compressParallel()) = %d, want close to %d`, parallel.Len(), single.Len())
+	}
+
+	if err := compressParallel(context.Background(), io.Discard, headerGzip, flate.DefaultCompression, bytes.NewReader(text[:10]), 20, 1000, 4); err == nil {
+		t.Error(`negronicompress.compressParallel() with short content = nil, want err`)
+	}
+}
+
+// limitWriter fails once more than n bytes are written to it.
+type limitWriter struct {
+	n int
+}
+
+var errLimit = errors.New(`write limit exceeded`)
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return 0, errLimit
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestCompressParallel_WriteError(t *testing.T) {
+	random := make([]byte, 300000)
+	rand.NewChaCha8([32]byte{5}).Read(random)
+
+	// The writer fails on one of the first blocks while the others are still
+	// being read and compressed.
+	for _, limit := range []int{0, 5000, 100000} {
+		err := compressParallel(context.Background(), &limitWriter{limit}, headerDeflate, flate.BestSpeed, bytes.NewReader(random), int64(len(random)), 1000, 4)
+		if err != errLimit {
+			t.Errorf(`negronicompress.compressParallel() with a writer failing after %d bytes = %v, want %v`, limit, err, errLimit)
+		}
+	}
+}
+
+func TestCompress_SetParallel(t *testing.T) {
+	handler := NewCompress()
+	handler.SetParallel(-1, 0, 0)
+	if handler.parallelThreshold != 0 || handler.parallelBlockSize != parallelBlockSize || handler.parallelWorkers != runtime.GOMAXPROCS(0) {
+		t.Errorf(`negronicompress.compress.SetParallel(-1, 0, 0) = %d, %d, %d; want %d, %d, %d`, handler.parallelThreshold, handler.parallelBlockSize, handler.parallelWorkers, 0, parallelBlockSize, runtime.GOMAXPROCS(0))
+	}
+	if handler.useParallel(headerGzip, 1<<30) {
+		t.Error(`negronicompress.compress.useParallel() = true with parallel compression disabled`)
+	}
+
+	handler.SetParallel(int64(mininumContentLength), 4096, 4)
+	if !handler.useParallel(headerGzip, int64(mininumContentLength)) || handler.useParallel(`br`, int64(mininumContentLength)) || handler.useParallel(headerGzip, 1) {
+		t.Error(`negronicompress.compress.useParallel() does not respect threshold and encoding`)
+	}
+
+	cnt := strings.Repeat(`parallel content `, mininumContentLength)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf(`gzip.NewReader() = _, %v; want _, nil`, err)
+	}
+	if b, err := io.ReadAll(zr); err != nil || string(b) != cnt {
+		t.Errorf(`decoded response body differs from original content, error %v`, err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+)
+
+// AssetIndex is the name of the index file describing precompressed assets,
+// as written by the negronicompress-gen command.
+const AssetIndex string = `negronicompress.json`
+
+// Asset describes a file together with its precompressed variants.
+type Asset struct {
+	// ContentType is the content type the file is sent with.
+	ContentType string `json:"contentType"`
+	// Variants holds the files of the asset by their content coding, with the
+	// original file under "identity".
+	Variants map[string]AssetVariant `json:"variants"`
+}
+
+// AssetVariant is a file holding an asset in one content coding.
+type AssetVariant struct {
+	// Path is the path of the file within the file system of the assets.
+	Path string `json:"path"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 hash of the file content.
+	SHA256 string `json:"sha256"`
+}
+
+// etag returns the strong entity tag of the variant, derived from its hash in
+// the same way as for files cached by FS.
+func (v AssetVariant) etag() string {
+	h := v.SHA256
+	if len(h) > 32 {
+		h = h[:32]
+	}
+
+	return `"` + h + `"`
+}
+
+// assetHandler serves precompressed assets.
+type assetHandler struct {
+	assets map[string]*assetFile
+}
+
+// assetFile is a precompressed asset of an assetHandler.
+type assetFile struct {
+	*Asset
+	fsys fs.FS
+	// encodings holds the encodings of the asset other than identity, in the
+	// order of preference.
+	encodings []string
+}
+
+// NewAssetHandler returns a handler serving precompressed assets from fsys,
+// as described by its AssetIndex file. Such assets are usually prepared by the
+// negronicompress-gen command and embedded into the binary.
+//
+// Each asset is served at its path within the index, with "index.html" served
+// for directories, in the precompressed variant the client prefers, so no
+// compression takes place at run time. Every variant is sent with its own
+// strong "ETag" and conditional and range requests are supported.
+func NewAssetHandler(fsys fs.FS) (*assetHandler, error) {
+	b, err := fs.ReadFile(fsys, AssetIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var index map[string]*Asset
+	if err = json.Unmarshal(b, &index); err != nil {
+		return nil, err
+	}
+	h := &assetHandler{assets: make(map[string]*assetFile, len(index))}
+	for name, a := range index {
+		var encodings []string
+		for _, e := range supportedEncodings {
+			if _, ok := a.Variants[e]; ok {
+				encodings = append(encodings, e)
+			}
+		}
+		// Encodings generated with codings unknown to this binary come last.
+		var unknown []string
+		for e := range a.Variants {
+			if e != headerIdentity && !slices.Contains(encodings, e) {
+				unknown = append(unknown, e)
+			}
+		}
+		slices.Sort(unknown)
+		h.assets[name] = &assetFile{Asset: a, fsys: fsys, encodings: append(encodings, unknown...)}
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveStatic(w, r, func(name string) (staticFile, error) {
+		if a, ok := h.assets[name]; ok {
+			return a, nil
+		}
+		return nil, fs.ErrNotExist
+	})
+}
+
+// info implements staticFile.
+func (a *assetFile) info() (string, []string) {
+	return a.ContentType, a.encodings
+}
+
+// open implements staticFile.
+func (a *assetFile) open(encoding string) (staticContent, error) {
+	v, ok := a.Variants[encoding]
+	if encoding == `` {
+		v, ok = a.Variants[headerIdentity]
+	}
+	if !ok {
+		return staticContent{}, fs.ErrNotExist
+	}
+
+	f, err := a.fsys.Open(v.Path)
+	if err != nil {
+		return staticContent{}, err
+	}
+	c := staticContent{encoding: encoding, etag: v.etag()}
+	if fi, err := f.Stat(); err == nil {
+		c.modTime = fi.ModTime()
+	}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		// Closed once served.
+		c.ReadSeeker = rs
+		return c, nil
+	}
+
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return staticContent{}, err
+	}
+	c.ReadSeeker = bytes.NewReader(b)
+	return c, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		AssetIndex: {Data: []byte(`{
+			"app.js": {"contentType": "text/javascript", "variants": {
+				"identity": {"path": "app.js", "size": 8, "sha256": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+				"gzip": {"path": "app.js.gz", "size": 6, "sha256": "1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+				"br": {"path": "app.js.br", "size": 5, "sha256": "2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+			}},
+			"logo.png": {"contentType": "image/png", "variants": {
+				"identity": {"path": "logo.png", "size": 4, "sha256": "3123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+			}}
+		}`)},
+		`app.js`:    {Data: []byte(`identity`)},
+		`app.js.gz`: {Data: []byte(`gzip..`)},
+		`app.js.br`: {Data: []byte(`br...`)},
+		`logo.png`:  {Data: []byte(`logo`)},
+	}
+	handler, err := NewAssetHandler(fsys)
+	if err != nil {
+		t.Fatalf(`negronicompress.NewAssetHandler() = _, %v; want _, nil`, err)
+	}
+
+	for _, e := range []struct {
+		path, accept    string
+		code            int
+		encoding, body  string
+		etag, vary, typ string
+	}{
+		{`/app.js`, `gzip, br`, http.StatusOK, headerGzip, `gzip..`, `"1123456789abcdef0123456789abcdef"`, headerAcceptEncoding, `text/javascript`},
+		{`/app.js`, `br, gzip;q=0.5`, http.StatusOK, `br`, `br...`, `"2123456789abcdef0123456789abcdef"`, headerAcceptEncoding, `text/javascript`},
+		{`/app.js`, `deflate`, http.StatusOK, ``, `identity`, `"0123456789abcdef0123456789abcdef"`, headerAcceptEncoding, `text/javascript`},
+		{`/logo.png`, `gzip`, http.StatusOK, ``, `logo`, `"3123456789abcdef0123456789abcdef"`, ``, `image/png`},
+		{`/missing.js`, `gzip`, http.StatusNotFound, ``, "404 page not found\n", ``, ``, `text/plain; charset=utf-8`},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost`+e.path, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		h := w.Header()
+		if w.Code != e.code || h.Get(headerContentEncoding) != e.encoding || w.Body.String() != e.body || h.Get(headerETag) != e.etag || h.Get(headerVary) != e.vary || h.Get(headerContentType) != e.typ {
+			t.Errorf(`negronicompress.assetHandler.ServeHTTP() for %s with %q = %d, %q, %q, %s, %q, %q; want %d, %q, %q, %s, %q, %q`, e.path, e.accept, w.Code, h.Get(headerContentEncoding), w.Body.String(), h.Get(headerETag), h.Get(headerVary), h.Get(headerContentType), e.code, e.encoding, e.body, e.etag, e.vary, e.typ)
+		}
+	}
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/app.js`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	req.Header.Set(`If-None-Match`, `"1123456789abcdef0123456789abcdef"`)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf(`negronicompress.assetHandler.ServeHTTP() with matching If-None-Match = %d, want %d`, w.Code, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import "net/http"
+
+// proxyTransport is a RoundTripper that forwards content encodings accepted
+// by the client to the upstream server.
+type proxyTransport struct {
+	rt http.RoundTripper
+}
+
+// NewProxyTransport returns a RoundTripper meant to be used as the Transport
+// of an httputil.ReverseProxy placed behind the middleware. It wraps rt, or
+// http.DefaultTransport if rt is nil.
+//
+// By default the transport asks the upstream server for gzip on behalf of
+// clients that did not send "Accept-Encoding" and decodes the response, only
+// for the middleware to compress it again. Such requests are sent with
+// "Accept-Encoding: identity" instead, while requests of other clients keep
+// their own encodings. Upstream responses encoded with one of them are then
+// passed through by the middleware untouched and identity responses are
+// compressed by the same rules as any other response.
+func NewProxyTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &proxyTransport{rt: rt}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Header.Get(headerAcceptEncoding) == `` {
+		// Requests must not be modified by a RoundTripper.
+		r = r.Clone(r.Context())
+		r.Header.Set(headerAcceptEncoding, headerIdentity)
+	}
+
+	return t.rt.RoundTrip(r)
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewProxyTransport(t *testing.T) {
+	cnt := strings.Repeat(`proxied `, 1000)
+	var gz bytes.Buffer
+	encode(&gz, headerGzip, flate.DefaultCompression, []byte(cnt))
+
+	var upstreamAccept string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamAccept = r.Header.Get(headerAcceptEncoding)
+		w.Header().Set(headerContentType, `text/plain`)
+		if acceptsEncoding(upstreamAccept, headerGzip) {
+			w.Header().Set(headerContentEncoding, headerGzip)
+			w.Write(gz.Bytes())
+			return
+		}
+		w.Write([]byte(cnt))
+	}))
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = NewProxyTransport(nil)
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		accept, upstreamAccept, encoding string
+		skipped                          SkipReason
+	}{
+		{``, headerIdentity, ``, SkipNotAccepted},
+		{headerGzip, headerGzip, headerGzip, SkipAlreadyEncoded},
+		{headerDeflate, headerDeflate, headerDeflate, ``},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), proxy.ServeHTTP)
+
+		if upstreamAccept != e.upstreamAccept {
+			t.Errorf(`upstream %s for client %q = %q, want %q`, headerAcceptEncoding, e.accept, upstreamAccept, e.upstreamAccept)
+		}
+		if ce := w.Header().Get(headerContentEncoding); ce != e.encoding || res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.compress.ServeHTTP() through proxy for %q = %q, skipped %q; want %q, %q`, e.accept, ce, res.Skipped, e.encoding, e.skipped)
+			continue
+		}
+		switch e.encoding {
+		case ``:
+			if w.Body.String() != cnt {
+				t.Errorf(`negronicompress.compress.ServeHTTP() through proxy for %q sent %d bytes, want original %d`, e.accept, w.Body.Len(), len(cnt))
+			}
+		case headerGzip:
+			if !bytes.Equal(w.Body.Bytes(), gz.Bytes()) {
+				t.Errorf(`negronicompress.compress.ServeHTTP() through proxy for %q did not pass upstream content through`, e.accept)
+			}
+		default:
+			dec, _ := NewDecoder(w.Body, e.encoding)
+			if b, _ := io.ReadAll(dec); string(b) != cnt {
+				t.Errorf(`negronicompress.compress.ServeHTTP() through proxy for %q decoded to %d bytes, want %d`, e.accept, len(b), len(cnt))
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"context"
+	"io"
+)
+
+// SetMinSavings sets the minimum fraction by which compression must reduce the
+// size of the content, for example 0.1 for 10%. If the compressed content is
+// not at least that much smaller, the original content is sent without
+// "Content-Encoding". Compressed content that is not smaller at all is never
+// sent, even with the default value of zero.
+//
+// If window is greater than zero, savings are first checked after compressing
+// only that many leading bytes of the content, so compression of content that
+// does not compress well is abandoned early.
+func (h *compress) SetMinSavings(ratio float64, window int) {
+	if ratio < 0 {
+		ratio = 0
+	} else if ratio > 1 {
+		ratio = 1
+	}
+	if window < 0 {
+		window = 0
+	}
+
+	h.minSavings, h.savingsWindow = ratio, window
+}
+
+// savingsSufficient reports whether compressing in bytes into out bytes saves
+// enough to be worth sending.
+func (h *compress) savingsSufficient(in, out int) bool {
+	return out < in && float64(out) <= float64(in)*(1-h.minSavings)
+}
+
+// compressContent writes n bytes read from src to w encoded with encoding at
+// the given compression level and returns the size of the encoded content. It
+// returns errNoSavings as soon as it is known that the encoded content will
+// not be sufficiently smaller than the original, or the error of ctx as soon as
+// it is done.
+func (h *compress) compressContent(ctx context.Context, w io.Writer, encoding string, level int, src io.Reader, n int64) (int, error) {
+	cw := &countWriter{w: w}
+	if h.useParallel(encoding, n) {
+		if err := compressParallel(ctx, cw, encoding, level, src, n, h.parallelBlockSize, h.parallelWorkers); err != nil {
+			return 0, err
+		}
+		if !h.savingsSufficient(int(n), int(cw.n)) {
+			return 0, errNoSavings
+		}
+		return int(cw.n), nil
+	}
+
+	wc, err := newEncoder(cw, encoding, level)
+	if err != nil {
+		return 0, err
+	}
+	defer wc.Close()
+
+	if window := int64(h.savingsWindow); window > 0 && n > window {
+		if err = copyContext(ctx, wc, io.LimitReader(src, window)); err != nil {
+			return 0, err
+		}
+		if err = wc.Flush(); err != nil {
+			return 0, err
+		}
+		if !h.savingsSufficient(int(window), int(cw.n)) {
+			return 0, errNoSavings
+		}
+	}
+
+	if err = copyContext(ctx, wc, src); err != nil {
+		return 0, err
+	}
+	if err = wc.Close(); err != nil {
+		return 0, err
+	}
+	if !h.savingsSufficient(int(n), int(cw.n)) {
+		return 0, errNoSavings
+	}
+
+	return int(cw.n), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress_SetMinSavings(t *testing.T) {
+	handler := NewCompress()
+	handler.SetMinSavings(-1, -1)
+	if handler.minSavings != 0 || handler.savingsWindow != 0 {
+		t.Errorf(`negronicompress.compress.SetMinSavings(-1, -1) = %f, %d; want %f, %d`, handler.minSavings, handler.savingsWindow, 0., 0)
+	}
+	handler.SetMinSavings(2, 10)
+	if handler.minSavings != 1 || handler.savingsWindow != 10 {
+		t.Errorf(`negronicompress.compress.SetMinSavings(2, 10) = %f, %d; want %f, %d`, handler.minSavings, handler.savingsWindow, 1., 10)
+	}
+}
+
+func TestCompress_SavingsSufficient(t *testing.T) {
+	handler := NewCompress()
+	for _, e := range []struct {
+		min     float64
+		in, out int
+		ok      bool
+	}{
+		{0, 100, 99, true},
+		{0, 100, 100, false},
+		{0, 100, 120, false},
+		{.2, 100, 80, true},
+		{.2, 100, 81, false},
+	} {
+		handler.minSavings = e.min
+		if ok := handler.savingsSufficient(e.in, e.out); ok != e.ok {
+			t.Errorf(`negronicompress.compress.savingsSufficient(%d, %d) with minimum %f = %t, want %t`, e.in, e.out, e.min, ok, e.ok)
+		}
+	}
+}
+
+func TestCompress_ServeHTTPMinSavings(t *testing.T) {
+	random := make([]byte, mininumContentLength*4)
+	rand.NewChaCha8([32]byte{2}).Read(random)
+	text := []byte(strings.Repeat(`text `, mininumContentLength))
+	// Compressible at first, random afterwards.
+	mixed := append(append([]byte{}, text[:mininumContentLength]...), random...)
+
+	handler := NewCompress()
+	for _, e := range []struct {
+		min     float64
+		window  int
+		body    []byte
+		skipped SkipReason
+	}{
+		{0, 0, random, SkipNoSavings},
+		{0, 0, text, ``},
+		{.5, 0, mixed, SkipNoSavings},
+		{.1, mininumContentLength, mixed, ``},
+		{.1, mininumContentLength, append(append([]byte{}, random...), text...), SkipNoSavings},
+	} {
+		handler.SetMinSavings(e.min, e.window)
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Write(e.body)
+		})
+		if res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.Result.Skipped with minimum %f and window %d = %q, want %q`, e.min, e.window, res.Skipped, e.skipped)
+		}
+		if e.skipped != `` {
+			if !bytes.Equal(w.Body.Bytes(), e.body) {
+				t.Errorf(`httptest.NewRecorder().Body.Bytes() differs from original content`)
+			}
+			if h := w.Header().Get(headerContentEncoding); h != `` {
+				t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentEncoding, h, ``)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"io"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// ShadowObserver is an optional interface implemented by observers that want to
+// be notified about compressions performed in shadow mode.
+type ShadowObserver interface {
+	// OnShadowCompressed is called after a copy of the response to r was
+	// compressed in the background with encoding from inSize to outSize bytes
+	// in time d. It is called from a different goroutine than the one that
+	// served the request.
+	OnShadowCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration)
+}
+
+// SetShadow switches the middleware into shadow mode. In shadow mode responses
+// are always sent in their original form, but for the given fraction of the
+// responses that would otherwise be compressed, a copy is compressed in the
+// background at the given level. The would-be sizes and timings are recorded
+// in the metrics and reported to observers implementing ShadowObserver. This
+// allows evaluating compression levels on real traffic without any risk.
+//
+// At most one background compression per CPU runs at a time and each of them
+// also takes a slot of the budget, if one is set. Responses sampled while no
+// slot is free are not measured.
+//
+// rate must be between 0 and 1, where 0 turns shadow mode off.
+func (h *compress) SetShadow(rate float64, level int) {
+	if rate < 0 {
+		rate = 0
+	} else if rate > 1 {
+		rate = 1
+	}
+
+	h.shadowRate, h.shadowLevel = rate, level
+	h.shadowSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+}
+
+// startShadow compresses the content buffered in crw in the background, unless
+// no slot for it is free. The budget reserved for the content is held until
+// the background compression is done.
+func (h *compress) startShadow(r *http.Request, encoding string, crw *compressResponseWriter) {
+	slots, budget := h.shadowSlots, h.budget
+	select {
+	case slots <- struct{}{}:
+	default:
+		return
+	}
+	if budget != nil && !budget.acquire() {
+		<-slots
+		return
+	}
+
+	// Buffer is never modified after this point, so it is safe to share it
+	// with the background compression.
+	b, reserved := crw.c, crw.reserved
+	crw.reserved = 0
+	go func() {
+		defer func() {
+			if budget != nil {
+				budget.release(reserved)
+				budget.done()
+			}
+			<-slots
+		}()
+		h.shadow(r, encoding, b)
+	}()
+}
+
+// shadow compresses b with encoding and records the results without sending
+// them anywhere.
+func (h *compress) shadow(r *http.Request, encoding string, b []byte) {
+	cw := &countWriter{w: io.Discard}
+	start := time.Now()
+	if err := encode(cw, encoding, h.shadowLevel, b); err != nil {
+		h.observer.OnError(r, err)
+		return
+	}
+	d := time.Since(start)
+
+	h.metrics.shadowCompress(len(b), int(cw.n), d)
+	if o, ok := h.observer.(ShadowObserver); ok {
+		o.OnShadowCompressed(r, encoding, len(b), int(cw.n), d)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/flate"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type shadowObserverTest struct {
+	observerTest
+	done chan [2]int
+}
+
+func (o *shadowObserverTest) OnShadowCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration) {
+	o.done <- [2]int{inSize, outSize}
+}
+
+func TestCompress_SetShadow(t *testing.T) {
+	handler := NewCompress()
+	handler.SetShadow(-1, flate.BestSpeed)
+	if handler.shadowRate != 0 {
+		t.Errorf(`negronicompress.compress.SetShadow(%f, _).shadowRate = %f, want %f`, -1., handler.shadowRate, 0.)
+	}
+	handler.SetShadow(2, flate.BestSpeed)
+	if handler.shadowRate != 1 || handler.shadowLevel != flate.BestSpeed {
+		t.Errorf(`negronicompress.compress.SetShadow(%f, %d) = %f, %d; want %f, %d`, 2., flate.BestSpeed, handler.shadowRate, handler.shadowLevel, 1., flate.BestSpeed)
+	}
+
+	o := &shadowObserverTest{done: make(chan [2]int, 1)}
+	handler.SetObserver(o)
+
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		w.Write([]byte(cnt))
+	})
+	if w.Body.String() != cnt {
+		t.Errorf(`httptest.NewRecorder().Body.String() = %q, want %q`, w.Body.String(), cnt)
+	}
+	if e := w.Header().Get(headerContentEncoding); e != `` {
+		t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentEncoding, e, ``)
+	}
+
+	select {
+	case s := <-o.done:
+		if s[0] != len(cnt) || s[1] == 0 || s[1] >= s[0] {
+			t.Errorf(`negronicompress.ShadowObserver.OnShadowCompressed() sizes = %v, want %d and less`, s, len(cnt))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`negronicompress.ShadowObserver.OnShadowCompressed() was not called`)
+	}
+
+	m := handler.Metrics()
+	if n := m.shadow.compressed.Load(); n != 1 {
+		t.Errorf(`negronicompress.Metrics.shadow.compressed = %d, want %d`, n, 1)
+	}
+	if n := counter(&m.skipped, SkipShadow).Load(); n != 1 {
+		t.Errorf(`negronicompress.Metrics.skipped[%q] = %d, want %d`, SkipShadow, n, 1)
+	}
+	if n := m.compressed.Load(); n != 0 {
+		t.Errorf(`negronicompress.Metrics.compressed = %d, want %d`, n, 0)
+	}
+}
+
+type shadowBudgetObserverTest struct {
+	observerTest
+	budget *Budget
+	done   chan [2]int64
+}
+
+func (o *shadowBudgetObserverTest) OnShadowCompressed(r *http.Request, encoding string, inSize, outSize int, d time.Duration) {
+	o.done <- [2]int64{o.budget.Bytes(), int64(o.budget.Concurrent())}
+}
+
+func TestCompress_ShadowLimits(t *testing.T) {
+	b := NewBudget(0, 1)
+	handler := NewCompress()
+	handler.SetShadow(1, flate.BestSpeed)
+	handler.SetBudget(b)
+	o := &shadowBudgetObserverTest{budget: b, done: make(chan [2]int64, 1)}
+	handler.SetObserver(o)
+
+	cnt := strings.Repeat(`.`, mininumContentLength+1)
+	serve := func() {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		handler.ServeHTTP(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Write([]byte(cnt))
+		})
+	}
+
+	// Buffer stays reserved while the background compression runs.
+	serve()
+	select {
+	case s := <-o.done:
+		if s[0] != int64(len(cnt)) || s[1] != 1 {
+			t.Errorf(`negronicompress.Budget during shadow compression = %d bytes, %d concurrent; want %d, %d`, s[0], s[1], len(cnt), 1)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`negronicompress.ShadowObserver.OnShadowCompressed() was not called`)
+	}
+	for deadline := time.Now().Add(5 * time.Second); b.Bytes() != 0 || b.Concurrent() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf(`negronicompress.Budget after shadow compression = %d bytes, %d concurrent; want 0, 0`, b.Bytes(), b.Concurrent())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Samples are dropped while no budget slot or shadow slot is free.
+	b.acquire()
+	serve()
+	b.done()
+	for len(handler.shadowSlots) < cap(handler.shadowSlots) {
+		handler.shadowSlots <- struct{}{}
+	}
+	serve()
+	select {
+	case <-o.done:
+		t.Error(`negronicompress.compress.ServeHTTP() started a shadow compression without a free slot`)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := handler.Metrics().shadow.compressed.Load(); n != 1 {
+		t.Errorf(`negronicompress.Metrics.shadow.compressed = %d, want %d`, n, 1)
+	}
+	if n := b.Bytes(); n != 0 {
+		t.Errorf(`negronicompress.Budget.Bytes() after dropped samples = %d, want 0`, n)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import "math"
+
+// entropySampleSize is the maximum number of leading bytes of the content used
+// to estimate its entropy.
+const entropySampleSize int = 4096
+
+// Signature describes a sequence of bytes that identifies content in a format
+// that is already compressed and will not benefit from further compression.
+type Signature struct {
+	// Name is a human readable name of the format.
+	Name string
+	// Offset is the position in the content where Magic is expected.
+	Offset int
+	// Magic is the identifying sequence of bytes.
+	Magic []byte
+	// Mask, if not empty, is applied to both the content and Magic before
+	// comparing them, so that bytes with a zero mask are ignored. It must be
+	// of the same length as Magic.
+	Mask []byte
+}
+
+// Match reports whether content b starts with the signature.
+func (s Signature) Match(b []byte) bool {
+	if len(b) < s.Offset+len(s.Magic) {
+		return false
+	}
+
+	b = b[s.Offset:]
+	for i, m := range s.Magic {
+		if len(s.Mask) == len(s.Magic) {
+			if b[i]&s.Mask[i] != m&s.Mask[i] {
+				return false
+			}
+		} else if b[i] != m {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compressedSignatures is a list of signatures of formats that are already
+// compressed.
+var compressedSignatures = []Signature{
+	{`gzip`, 0, []byte{0x1f, 0x8b}, nil},
+	{`zip`, 0, []byte("PK\x03\x04"), nil},
+	{`png`, 0, []byte("\x89PNG\r\n\x1a\n"), nil},
+	{`jpeg`, 0, []byte{0xff, 0xd8, 0xff}, nil},
+	{`gif`, 0, []byte(`GIF8`), nil},
+	{`webp`, 0, []byte("RIFF\x00\x00\x00\x00WEBP"), []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}},
+	{`zstd`, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}, nil},
+	{`7z`, 0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, nil},
+	{`xz`, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, nil},
+	{`bzip2`, 0, []byte(`BZh`), nil},
+	{`mp4`, 4, []byte(`ftyp`), nil},
+	{`woff2`, 0, []byte(`wOF2`), nil},
+}
+
+// AddSignature adds new signatures to the global list of signatures of already
+// compressed formats. All new middleware instances instantiated after this
+// function call will skip compression of content matching any of them.
+func AddSignature(s ...Signature) {
+	compressedSignatures = append(compressedSignatures[:len(compressedSignatures):len(compressedSignatures)], s...)
+}
+
+// AddSignature adds new signatures to the middleware list of signatures of
+// already compressed formats. Content matching any of them will not be
+// compressed even if its content type allows it.
+func (h *compress) AddSignature(s ...Signature) {
+	h.signatures = append(h.signatures[:len(h.signatures):len(h.signatures)], s...)
+}
+
+// SetEntropyThreshold enables skipping compression of content that does not
+// match any known signature, but whose estimated entropy in bits per byte is
+// at or above bits. The estimate is made on a small sample from the start of
+// the content. Random or already compressed data is close to 8 bits per byte,
+// while text is usually below 5. Zero disables the check.
+func (h *compress) SetEntropyThreshold(bits float64) {
+	h.entropyThreshold = bits
+}
+
+// matchSignature returns the first signature from signatures that b matches.
+func matchSignature(signatures []Signature, b []byte) (Signature, bool) {
+	for _, s := range signatures {
+		if s.Match(b) {
+			return s, true
+		}
+	}
+
+	return Signature{}, false
+}
+
+// entropy returns the Shannon entropy in bits per byte of the first
+// entropySampleSize bytes of b.
+func entropy(b []byte) float64 {
+	if len(b) > entropySampleSize {
+		b = b[:entropySampleSize]
+	}
+	if len(b) == 0 {
+		return 0
+	}
+
+	var freq [256]int
+	for _, c := range b {
+		freq[c]++
+	}
+
+	var e float64
+	n := float64(len(b))
+	for _, f := range freq {
+		if f > 0 {
+			p := float64(f) / n
+			e -= p * math.Log2(p)
+		}
+	}
+
+	return e
+}
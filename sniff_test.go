@@ -0,0 +1,117 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignature_Match(t *testing.T) {
+	for _, e := range []struct {
+		content string
+		name    string
+	}{
+		{"\x1f\x8b\x08\x00", `gzip`},
+		{"PK\x03\x04rest", `zip`},
+		{"\x89PNG\r\n\x1a\n....", `png`},
+		{"\xff\xd8\xff\xe0", `jpeg`},
+		{"RIFF\x10\x20\x30\x40WEBPVP8 ", `webp`},
+		{"RIFF\x10\x20\x30\x40WAVEfmt ", ``},
+		{"\x28\xb5\x2f\xfd....", `zstd`},
+		{"7z\xbc\xaf\x27\x1c", `7z`},
+		{"\x00\x00\x00\x20ftypisom", `mp4`},
+		{`<html></html>`, ``},
+		{"\x1f", ``},
+		{``, ``},
+	} {
+		s, ok := matchSignature(compressedSignatures, []byte(e.content))
+		if ok != (e.name != ``) || s.Name != e.name {
+			t.Errorf(`negronicompress.matchSignature(_, %q) = %q, %t; want %q, %t`, e.content, s.Name, ok, e.name, e.name != ``)
+		}
+	}
+}
+
+func TestAddSignature(t *testing.T) {
+	sOrig := compressedSignatures
+	handler := NewCompress()
+
+	AddSignature(Signature{`test`, 0, []byte(`TEST`), nil})
+	if _, ok := matchSignature(compressedSignatures, []byte(`TEST`)); !ok {
+		t.Errorf(`negronicompress.AddSignature() did not add signature to global list`)
+	}
+	if handler.isCompressed([]byte(`TEST`)) {
+		t.Errorf(`negronicompress.AddSignature() changed signatures of existing middleware`)
+	}
+	if len(sOrig) != len(compressedSignatures)-1 {
+		t.Fatalf(`len(negronicompress.compressedSignatures) = %d, want %d`, len(compressedSignatures), len(sOrig)+1)
+	}
+	compressedSignatures = sOrig
+
+	handler.AddSignature(Signature{`test`, 2, []byte(`ST`), nil})
+	if !handler.isCompressed([]byte(`TEST`)) {
+		t.Errorf(`negronicompress.compress.AddSignature() did not add signature`)
+	}
+	if _, ok := matchSignature(compressedSignatures, []byte(`TEST`)); ok {
+		t.Errorf(`negronicompress.compress.AddSignature() changed global signature list`)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if e := entropy(nil); e != 0 {
+		t.Errorf(`negronicompress.entropy(nil) = %f, want %f`, e, 0.)
+	}
+	if e := entropy(bytes.Repeat([]byte{'a'}, 100)); e != 0 {
+		t.Errorf(`negronicompress.entropy("aaa...") = %f, want %f`, e, 0.)
+	}
+	if e := entropy([]byte(`abab`)); e != 1 {
+		t.Errorf(`negronicompress.entropy("abab") = %f, want %f`, e, 1.)
+	}
+
+	b := make([]byte, entropySampleSize*2)
+	r := rand.NewChaCha8([32]byte{})
+	r.Read(b)
+	if e := entropy(b); e < 7.5 {
+		t.Errorf(`negronicompress.entropy(random) = %f, want at least %f`, e, 7.5)
+	}
+}
+
+func TestCompress_ServeHTTPSniff(t *testing.T) {
+	random := make([]byte, mininumContentLength*2)
+	rand.NewChaCha8([32]byte{1}).Read(random)
+
+	handler := NewCompress()
+	handler.AddContentType(`application/octet-stream`)
+	for _, e := range []struct {
+		threshold float64
+		body      []byte
+		skipped   SkipReason
+	}{
+		{0, append([]byte("PK\x03\x04"), bytes.Repeat([]byte{0}, mininumContentLength)...), SkipAlreadyCompressed},
+		{0, random, SkipNoSavings},
+		{7.5, random, SkipHighEntropy},
+		{7.5, []byte(strings.Repeat(`text `, mininumContentLength)), ``},
+	} {
+		handler.SetEntropyThreshold(e.threshold)
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `application/octet-stream`)
+			w.Write(e.body)
+		})
+		if res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.Result.Skipped = %q, want %q`, res.Skipped, e.skipped)
+		}
+		if e.skipped != `` && !bytes.Equal(w.Body.Bytes(), e.body) {
+			t.Errorf(`httptest.NewRecorder().Body.Bytes() differs from original content`)
+		}
+	}
+}
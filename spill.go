@@ -0,0 +1,91 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// spillPattern is the name pattern of temporary files.
+const spillPattern string = `negronicompress-*`
+
+// SetSpill makes the middleware move buffered response content to a temporary
+// file in dir once it grows over threshold bytes. The compressed content of
+// such responses is written to a temporary file as well. This keeps memory
+// usage low while still allowing the exact "Content-Length" of very large
+// responses to be sent. Temporary files are removed as soon as the response is
+// sent or the request is aborted. An empty dir means the default directory for
+// temporary files is used and zero threshold keeps all content in memory.
+// Content that cannot be moved to a temporary file is sent uncompressed.
+func (h *compress) SetSpill(threshold int64, dir string) {
+	if threshold < 0 {
+		threshold = 0
+	}
+
+	h.spillThreshold, h.spillDir = threshold, dir
+}
+
+// tempFile creates a new temporary file that is removed on cleanup.
+func (m *compressResponseWriter) tempFile() (*os.File, error) {
+	f, err := os.CreateTemp(m.spillDir, spillPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	m.files = append(m.files, f)
+	return f, nil
+}
+
+// spill moves buffered data to a temporary file.
+func (m *compressResponseWriter) spill() error {
+	f, err := m.tempFile()
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(m.c); err != nil {
+		return err
+	}
+
+	// Data is no longer held in memory.
+	m.release()
+	m.f = f
+	if len(m.c) > entropySampleSize {
+		m.c = m.c[:entropySampleSize:entropySampleSize]
+	}
+	return nil
+}
+
+// buffered returns the number of buffered bytes.
+func (m *compressResponseWriter) buffered() int64 {
+	return m.n
+}
+
+// head returns leading bytes of the buffered data.
+func (m *compressResponseWriter) head() []byte {
+	return m.c
+}
+
+// reader returns a reader of all buffered data.
+func (m *compressResponseWriter) reader() (io.Reader, error) {
+	if m.f == nil {
+		return bytes.NewReader(m.c), nil
+	}
+	if _, err := m.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return m.f, nil
+}
+
+// cleanup closes and removes all temporary files.
+func (m *compressResponseWriter) cleanup() {
+	for _, f := range m.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	m.files, m.f = nil, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/negroni"
+)
+
+func TestCompress_SetSpill(t *testing.T) {
+	dir := t.TempDir()
+	handler := NewCompress()
+	handler.SetSpill(-1, dir)
+	if handler.spillThreshold != 0 {
+		t.Errorf(`negronicompress.compress.SetSpill(-1, _).spillThreshold = %d, want %d`, handler.spillThreshold, 0)
+	}
+	handler.SetSpill(int64(mininumContentLength), dir)
+
+	cnt := strings.Repeat(`spilled content `, mininumContentLength)
+	for _, e := range []struct {
+		contentType, encoding string
+	}{
+		{`text/plain`, headerGzip},
+		{`image/png`, ``},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		w := httptest.NewRecorder()
+		var spilled bool
+		handler.ServeHTTP(w, req, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, e.contentType)
+			for i := 0; i < len(cnt); i += 1000 {
+				w.Write([]byte(cnt[i:min(i+1000, len(cnt))]))
+			}
+			entries, _ := os.ReadDir(dir)
+			spilled = len(entries) == 1
+		})
+
+		if !spilled {
+			t.Errorf(`negronicompress.compressResponseWriter did not spill content to %q`, dir)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf(`os.ReadDir(%q) = %d entries, want %d`, dir, len(entries), 0)
+		}
+		if l := w.Header().Get(headerContentLength); l != strconv.Itoa(w.Body.Len()) {
+			t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentLength, l, strconv.Itoa(w.Body.Len()))
+		}
+		if h := w.Header().Get(headerContentEncoding); h != e.encoding {
+			t.Errorf(`httptest.NewRecorder().Header().Get(%q) = %q, want %q`, headerContentEncoding, h, e.encoding)
+		}
+
+		var body io.Reader = w.Body
+		if e.encoding == headerGzip {
+			var err error
+			if body, err = gzip.NewReader(w.Body); err != nil {
+				t.Fatalf(`gzip.NewReader() = _, %v; want _, nil`, err)
+			}
+		}
+		if b, err := io.ReadAll(body); err != nil || string(b) != cnt {
+			t.Errorf(`decoded response body differs from original content, error %v`, err)
+		}
+	}
+}
+
+func TestCompress_SpillError(t *testing.T) {
+	handler := NewCompress()
+	handler.SetSpill(int64(mininumContentLength), filepath.Join(t.TempDir(), `missing`))
+
+	cnt := strings.Repeat(`unspilled content `, mininumContentLength)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	ctx, res := NewResultContext(req.Context())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, `text/plain`)
+		for i := 0; i < len(cnt); i += 1000 {
+			if _, err := w.Write([]byte(cnt[i:min(i+1000, len(cnt))])); err != nil {
+				t.Fatalf(`negronicompress.compressResponseWriter.Write() = _, %v; want _, nil`, err)
+			}
+		}
+	})
+
+	if res.Skipped != SkipError || w.Body.String() != cnt {
+		t.Errorf(`negronicompress.compress.ServeHTTP() failing to spill = skipped %q, %d bytes; want %q, %d bytes`, res.Skipped, w.Body.Len(), SkipError, len(cnt))
+	}
+}
+
+func TestCompress_SpillPanic(t *testing.T) {
+	dir := t.TempDir()
+	handler := NewCompress()
+	handler.SetSpill(1, dir)
+
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerGzip)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error(`negronicompress.compress.ServeHTTP() did not propagate panic`)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`spilled`))
+			panic(`test`)
+		})
+	}()
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf(`os.ReadDir(%q) = %d entries, want %d`, dir, len(entries), 0)
+	}
+}
+
+func TestCompressResponseWriter_Spill(t *testing.T) {
+	crw := &compressResponseWriter{
+		c:              make([]byte, 0),
+		ResponseWriter: negroni.NewResponseWriter(httptest.NewRecorder()),
+		spillThreshold: 4,
+		spillDir:       t.TempDir(),
+	}
+	defer crw.cleanup()
+
+	for _, b := range []string{`ab`, `cd`, `ef`} {
+		if n, err := crw.Write([]byte(b)); n != 2 || err != nil {
+			t.Fatalf(`negronicompress.compressResponseWriter.Write(%q) = %d, %v; want %d, nil`, b, n, err, 2)
+		}
+	}
+	if crw.f == nil {
+		t.Fatal(`negronicompress.compressResponseWriter.f = nil, want spilled file`)
+	}
+	if n := crw.buffered(); n != 6 {
+		t.Errorf(`negronicompress.compressResponseWriter.buffered() = %d, want %d`, n, 6)
+	}
+	if h := string(crw.head()); h != `abcdef` {
+		t.Errorf(`negronicompress.compressResponseWriter.head() = %q, want %q`, h, `abcdef`)
+	}
+	r, err := crw.reader()
+	if err != nil {
+		t.Fatalf(`negronicompress.compressResponseWriter.reader() = _, %v; want _, nil`, err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != `abcdef` {
+		t.Errorf(`negronicompress.compressResponseWriter.reader() content = %q, want %q`, b, `abcdef`)
+	}
+}
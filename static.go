@@ -0,0 +1,96 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// indexFile is the name of the file served for directories.
+const indexFile string = `index.html`
+
+// staticFile is a file available in several content codings that is served by
+// serveStatic.
+type staticFile interface {
+	// info returns the content type of the file and the content codings other
+	// than identity it can be sent in, in the order of preference.
+	info() (contentType string, encodings []string)
+	// open returns the content of the file in encoding, where empty encoding
+	// stands for identity. The content may end up in a different encoding
+	// than asked for.
+	open(encoding string) (staticContent, error)
+}
+
+// staticContent is the content of a static file in one content coding.
+type staticContent struct {
+	io.ReadSeeker
+	// encoding is the content coding of the content, empty for identity.
+	encoding string
+	// etag is the strong entity tag of the content.
+	etag    string
+	modTime time.Time
+}
+
+// serveStatic serves the file at the path of r, or "index.html" for
+// directories, as found by find. The file is sent in the content coding the
+// client prefers and conditional and range requests are supported. find is
+// given the path without a leading slash and returns an error wrapping
+// fs.ErrNotExist if there is no such file.
+func serveStatic(w http.ResponseWriter, r *http.Request, find func(name string) (staticFile, error)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set(`Allow`, `GET, HEAD`)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean(`/` + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, `/`) {
+		name = path.Join(name, indexFile)
+	}
+	f, err := find(strings.TrimPrefix(name, `/`))
+	if err != nil {
+		staticError(w, r, err)
+		return
+	}
+
+	header := w.Header()
+	contentType, encodings := f.info()
+	header.Set(headerContentType, contentType)
+	encoding := ``
+	if len(encodings) > 0 {
+		addVary(header, headerAcceptEncoding)
+		encoding = negotiate(r.Header.Get(headerAcceptEncoding), encodings)
+	}
+	c, err := f.open(encoding)
+	if err != nil {
+		staticError(w, r, err)
+		return
+	}
+	if closer, ok := c.ReadSeeker.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if c.encoding != `` {
+		header.Set(headerContentEncoding, c.encoding)
+	}
+	header.Set(headerETag, c.etag)
+
+	http.ServeContent(w, r, name, c.modTime, c.ReadSeeker)
+}
+
+// staticError responds to r with the status matching err.
+func staticError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
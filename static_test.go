@@ -0,0 +1,67 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type staticFileTest struct {
+	err error
+}
+
+func (f staticFileTest) info() (string, []string) {
+	return `text/plain`, []string{headerGzip}
+}
+
+func (f staticFileTest) open(encoding string) (staticContent, error) {
+	if f.err != nil {
+		return staticContent{}, f.err
+	}
+
+	return staticContent{ReadSeeker: strings.NewReader(`static ` + encoding), encoding: encoding, etag: `"` + encoding + `"`}, nil
+}
+
+func TestServeStatic(t *testing.T) {
+	for _, e := range []struct {
+		method, path string
+		findErr      error
+		openErr      error
+		code         int
+		name, body   string
+	}{
+		{`GET`, `/a/b.txt`, nil, nil, http.StatusOK, `a/b.txt`, `static gzip`},
+		{`HEAD`, `/a/../c/`, nil, nil, http.StatusOK, `c/index.html`, ``},
+		{`POST`, `/a/b.txt`, nil, nil, http.StatusMethodNotAllowed, ``, "Method Not Allowed\n"},
+		{`GET`, `/a/b.txt`, fs.ErrNotExist, nil, http.StatusNotFound, `a/b.txt`, "404 page not found\n"},
+		{`GET`, `/a/b.txt`, nil, fmt.Errorf(`wrapped: %w`, fs.ErrNotExist), http.StatusNotFound, `a/b.txt`, "404 page not found\n"},
+		{`GET`, `/a/b.txt`, nil, errors.New(`broken`), http.StatusInternalServerError, `a/b.txt`, "Internal Server Error\n"},
+	} {
+		req, _ := http.NewRequest(e.method, `http://localhost`+e.path, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		w := httptest.NewRecorder()
+		var name string
+		serveStatic(w, req, func(n string) (staticFile, error) {
+			name = n
+			return staticFileTest{e.openErr}, e.findErr
+		})
+
+		if w.Code != e.code || name != e.name || w.Body.String() != e.body {
+			t.Errorf(`negronicompress.serveStatic() %s %s = %d, %q, %q; want %d, %q, %q`, e.method, e.path, w.Code, name, w.Body.String(), e.code, e.name, e.body)
+		}
+		if e.code == http.StatusMethodNotAllowed && w.Header().Get(`Allow`) != `GET, HEAD` {
+			t.Errorf(`negronicompress.serveStatic() %s %s sent Allow %q, want %q`, e.method, e.path, w.Header().Get(`Allow`), `GET, HEAD`)
+		}
+		if e.code == http.StatusOK && (w.Header().Get(headerContentEncoding) != headerGzip || w.Header().Get(headerETag) != `"gzip"`) {
+			t.Errorf(`negronicompress.serveStatic() %s %s sent %s %q, %s %q; want %q, %q`, e.method, e.path, headerContentEncoding, w.Header().Get(headerContentEncoding), headerETag, w.Header().Get(headerETag), headerGzip, `"gzip"`)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"net/http"
+	"time"
+)
+
+// streamWriter compresses data written to it on the fly.
+type streamWriter struct {
+	enc         Encoder
+	encoding    string
+	contentType string
+	// in is the number of bytes written.
+	in int64
+	// out counts the compressed bytes sent to the client.
+	out *countWriter
+	// start is the time compression started.
+	start time.Time
+	// budget, if set, holds the slot taken by the compression.
+	budget *Budget
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	n, err := s.enc.Write(b)
+	s.in += int64(n)
+	return n, err
+}
+
+// Flush sends the data written so far to the client right away, as expected by
+// handlers streaming their responses. Buffering stops and, if the response can
+// be compressed, it is compressed on the fly from then on. Each flush then
+// also flushes the compressor.
+func (m *compressResponseWriter) Flush() {
+	if !m.passthrough {
+		reason := SkipFlush
+		if m.startStream != nil {
+			m.stream, reason = m.startStream()
+		}
+		if err := m.pass(reason); err != nil {
+			return
+		}
+	}
+	if m.stream != nil {
+		if err := m.stream.enc.Flush(); err != nil {
+			return
+		}
+	}
+
+	m.ResponseWriter.Flush()
+}
+
+// startStream returns a writer compressing the response to r with encoding on
+// the fly, or the reason why the response should be sent as is. It is called
+// when the handler flushes the response before it is complete, so the size of
+// the content is not known.
+func (h *compress) startStream(r *http.Request, res *Result, crw *compressResponseWriter, encoding string) (*streamWriter, SkipReason) {
+	contentType := crw.Header().Get(headerContentType)
+	switch {
+	case crw.Header().Get(headerContentEncoding) != ``:
+		return nil, SkipAlreadyEncoded
+	case encoding == ``:
+		return nil, SkipNotAccepted
+	case !compressibleStatus(crw.status):
+		return nil, SkipStatus
+	case headerHasToken(crw.Header(), headerCacheControl, `no-transform`):
+		return nil, SkipNoTransform
+	case !h.compressContentTypeRegEx.MatchString(contentType):
+		return nil, SkipContentType
+	case h.isCompressed(crw.head()):
+		return nil, SkipAlreadyCompressed
+	case h.shadowRate > 0:
+		return nil, SkipShadow
+	}
+
+	level, ok := h.level(res, encoding, contentType)
+	if !ok {
+		return nil, SkipOverload
+	}
+	if h.budget != nil && !h.budget.acquire() {
+		return nil, SkipConcurrency
+	}
+	out := &countWriter{w: crw.ResponseWriter}
+	enc, err := newEncoder(out, encoding, level)
+	if err != nil {
+		if h.budget != nil {
+			h.budget.done()
+		}
+		h.observer.OnError(r, err)
+		return nil, SkipError
+	}
+
+	setEncoding(crw.Header(), encoding)
+	crw.Header().Del(headerContentLength)
+	if crw.explain {
+		explainStream(crw.Header(), encoding)
+	}
+	return &streamWriter{enc: enc, encoding: encoding, contentType: contentType, out: out, start: time.Now(), budget: h.budget}, ``
+}
+
+// release frees the budget slot held by the compression, if any.
+func (s *streamWriter) release() {
+	if s.budget != nil {
+		s.budget.done()
+		s.budget = nil
+	}
+}
+
+// finishStream completes the response to r compressed on the fly by s. The
+// recorded duration covers the whole time since the first flush.
+func (h *compress) finishStream(r *http.Request, res *Result, s *streamWriter) {
+	if err := s.enc.Close(); err != nil {
+		h.observer.OnError(r, err)
+		return
+	}
+
+	res.Encoding, res.InSize, res.OutSize, res.Duration = s.encoding, int(s.in), int(s.out.n), time.Since(s.start)
+	h.metrics.compress(s.encoding, s.contentType, res.InSize, res.OutSize, res.Duration)
+	h.observer.OnCompressed(r, s.encoding, res.InSize, res.OutSize, res.Duration)
+}
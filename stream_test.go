@@ -0,0 +1,105 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponseWriter_Flush(t *testing.T) {
+	cnt := strings.Repeat(`streamed `, 1000)
+	handler := NewCompress()
+
+	for _, e := range []struct {
+		contentType, encoding string
+		skipped               SkipReason
+	}{
+		{`text/plain`, headerGzip, ``},
+		{`image/png`, ``, SkipContentType},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		var flushed int
+		handler.ServeHTTP(w, req.WithContext(ctx), func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set(headerContentType, e.contentType)
+			rw.Header().Set(headerContentLength, `1`)
+			rw.Write([]byte(cnt[:len(cnt)/2]))
+			rw.(http.Flusher).Flush()
+			flushed = w.Body.Len()
+			rw.Write([]byte(cnt[len(cnt)/2:]))
+		})
+
+		if flushed == 0 || !w.Flushed {
+			t.Errorf(`negronicompress.compressResponseWriter.Flush() of %s sent %d bytes, want data sent right away`, e.contentType, flushed)
+		}
+		if ce := w.Header().Get(headerContentEncoding); ce != e.encoding || res.Encoding != e.encoding || res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.compress.ServeHTTP() of flushed %s = %q, result %q, skipped %q; want %q, %q, %q`, e.contentType, ce, res.Encoding, res.Skipped, e.encoding, e.encoding, e.skipped)
+			continue
+		}
+		if e.encoding != `` && (w.Header().Get(headerContentLength) != `` || res.InSize != len(cnt) || res.OutSize != w.Body.Len()) {
+			t.Errorf(`negronicompress.compress.ServeHTTP() of flushed %s = length %q, sizes %d/%d; want no length, sizes %d/%d`, e.contentType, w.Header().Get(headerContentLength), res.InSize, res.OutSize, len(cnt), w.Body.Len())
+		}
+
+		b := w.Body.Bytes()
+		if e.encoding != `` {
+			dec, _ := NewDecoder(w.Body, e.encoding)
+			b, _ = io.ReadAll(dec)
+		}
+		if string(b) != cnt {
+			t.Errorf(`negronicompress.compress.ServeHTTP() of flushed %s decoded to %d bytes, want %d`, e.contentType, len(b), len(cnt))
+		}
+	}
+}
+
+func TestCompressResponseWriter_FlushBudget(t *testing.T) {
+	cnt := strings.Repeat(`streamed `, 1000)
+	budget := NewBudget(0, 1)
+	handler := NewCompress()
+	handler.SetBudget(budget)
+
+	for _, e := range []struct {
+		busy     bool
+		encoding string
+		skipped  SkipReason
+	}{
+		{false, headerGzip, ``},
+		{true, ``, SkipConcurrency},
+	} {
+		if e.busy {
+			budget.acquire()
+		}
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		var concurrent int
+		handler.ServeHTTP(w, req.WithContext(ctx), func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set(headerContentType, `text/plain`)
+			rw.Write([]byte(cnt[:len(cnt)/2]))
+			rw.(http.Flusher).Flush()
+			concurrent = budget.Concurrent()
+			rw.Write([]byte(cnt[len(cnt)/2:]))
+		})
+		if e.busy {
+			budget.done()
+		}
+
+		if ce := w.Header().Get(headerContentEncoding); ce != e.encoding || res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.compress.ServeHTTP() of flushed response with busy budget %v = %q, skipped %q; want %q, %q`, e.busy, ce, res.Skipped, e.encoding, e.skipped)
+		}
+		if concurrent != 1 {
+			t.Errorf(`negronicompress.Budget.Concurrent() while streaming with busy budget %v = %d, want %d`, e.busy, concurrent, 1)
+		}
+		if n := budget.Concurrent(); n != 0 {
+			t.Errorf(`negronicompress.Budget.Concurrent() after streaming = %d, want %d`, n, 0)
+		}
+	}
+}
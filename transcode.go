@@ -0,0 +1,62 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"io"
+)
+
+// SetTranscode enables transcoding of content that is already encoded, for
+// example by a proxied upstream server or as a precompressed file, with an
+// encoding the client does not accept. Such content is decoded and then either
+// compressed again with an encoding the client accepts or sent as is. Only
+// content that decodes to at most limit bytes is transcoded, the rest is sent
+// in its original encoding. Zero limit disables transcoding.
+//
+// Note that with transcoding enabled, responses to clients that do not accept
+// any supported encoding are buffered as well.
+func (h *compress) SetTranscode(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+
+	h.transcodeLimit = limit
+}
+
+// transcode replaces content buffered in crw and encoded with encoding by its
+// decoded form. It returns false if the content does not fit within the
+// transcoding limit and should be sent as is.
+func (h *compress) transcode(crw *compressResponseWriter, encoding string) (bool, error) {
+	if crw.buffered() > h.transcodeLimit {
+		// Encoded content is hardly ever larger than decoded one.
+		return false, nil
+	}
+
+	src, err := crw.reader()
+	if err != nil {
+		return false, err
+	}
+	dec, err := NewDecoder(src, encoding)
+	if err != nil {
+		return false, err
+	}
+	defer dec.Close()
+
+	var b bytes.Buffer
+	if n, err := io.Copy(&b, io.LimitReader(dec, h.transcodeLimit+1)); err != nil {
+		return false, err
+	} else if n > h.transcodeLimit || !crw.reserve(b.Len()) {
+		return false, nil
+	}
+
+	// Decoded content is small enough to be kept in memory.
+	crw.cleanup()
+	crw.c, crw.n = b.Bytes(), int64(b.Len())
+	crw.Header().Del(headerContentEncoding)
+	crw.Header().Del(headerContentLength)
+	setTransformed(crw.Header())
+	return true, nil
+}
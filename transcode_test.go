@@ -0,0 +1,107 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	for _, e := range []struct {
+		accept, coding string
+		ok             bool
+	}{
+		{``, headerGzip, false},
+		{`gzip`, headerGzip, true},
+		{`GZIP;q=0.5`, headerGzip, true},
+		{`gzip;q=0`, headerGzip, false},
+		{`deflate`, headerGzip, false},
+		{`*`, headerGzip, true},
+		{`*, gzip;q=0`, headerGzip, false},
+		{`*;q=0, gzip`, headerGzip, true},
+	} {
+		if ok := acceptsEncoding(e.accept, e.coding); ok != e.ok {
+			t.Errorf(`negronicompress.acceptsEncoding(%q, %q) = %t, want %t`, e.accept, e.coding, ok, e.ok)
+		}
+	}
+}
+
+func TestCompress_SetTranscode(t *testing.T) {
+	cnt := strings.Repeat(`transcode me `, 1000)
+	var gz bytes.Buffer
+	encode(&gz, headerGzip, flate.DefaultCompression, []byte(cnt))
+
+	handler := NewCompress()
+	for _, e := range []struct {
+		limit             int64
+		accept            string
+		encoding, decoded string
+		skipped           SkipReason
+	}{
+		{0, headerDeflate, headerGzip, ``, SkipAlreadyEncoded},
+		{int64(len(cnt)), headerGzip, headerGzip, ``, SkipAlreadyEncoded},
+		{int64(len(cnt)), headerDeflate, headerDeflate, headerGzip, ``},
+		{int64(len(cnt)), `identity`, ``, headerGzip, SkipNotAccepted},
+		{int64(len(cnt)) - 1, headerDeflate, headerGzip, ``, SkipAlreadyEncoded},
+	} {
+		handler.SetTranscode(e.limit)
+		req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		ctx, res := NewResultContext(req.Context())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerContentType, `text/plain`)
+			w.Header().Set(headerContentEncoding, headerGzip)
+			w.Write(gz.Bytes())
+		})
+
+		if ce := w.Header().Get(headerContentEncoding); ce != e.encoding || res.Decoded != e.decoded || res.Skipped != e.skipped {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with limit %d for %q = %q, decoded %q, skipped %q; want %q, %q, %q`, e.limit, e.accept, ce, res.Decoded, res.Skipped, e.encoding, e.decoded, e.skipped)
+			continue
+		}
+		var b []byte
+		if e.encoding == `` {
+			b = w.Body.Bytes()
+		} else {
+			dec, _ := NewDecoder(w.Body, e.encoding)
+			b, _ = io.ReadAll(dec)
+		}
+		if string(b) != cnt {
+			t.Errorf(`negronicompress.compress.ServeHTTP() with limit %d for %q decoded to %d bytes, want %d`, e.limit, e.accept, len(b), len(cnt))
+		}
+	}
+}
+
+func TestCompress_SetTranscodeLimit(t *testing.T) {
+	const limit = 1024
+	chunk := bytes.Repeat([]byte{0x1f, 0x8b, 0x08}, 200)
+
+	handler := NewCompress()
+	handler.SetTranscode(limit)
+	req, _ := http.NewRequest(`GET`, `http://localhost/foo`, nil)
+	req.Header.Set(headerAcceptEncoding, headerDeflate)
+	ctx, res := NewResultContext(req.Context())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(ctx), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set(headerContentType, `text/plain`)
+		rw.Header().Set(headerContentEncoding, headerGzip)
+		for i := 0; i < 100; i++ {
+			rw.Write(chunk)
+			if n := rw.(*compressResponseWriter).buffered(); n > limit {
+				t.Fatalf(`negronicompress.compressResponseWriter.buffered() after %d bytes of encoded content = %d, want at most %d`, (i+1)*len(chunk), n, limit)
+			}
+		}
+	})
+
+	if ce := w.Header().Get(headerContentEncoding); ce != headerGzip || res.Skipped != SkipAlreadyEncoded || w.Body.Len() != 100*len(chunk) {
+		t.Errorf(`negronicompress.compress.ServeHTTP() of encoded content over the limit = %q, skipped %q, %d bytes; want %q, %q, %d bytes`, ce, res.Skipped, w.Body.Len(), headerGzip, SkipAlreadyEncoded, 100*len(chunk))
+	}
+}
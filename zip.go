@@ -0,0 +1,217 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// zipEncodings are the content encodings deflated ZIP entries can be sent in
+// without recompression, in the order of preference.
+var zipEncodings = []string{headerGzip, headerDeflate}
+
+// zipFlagEncrypted is the general purpose bit flag of encrypted ZIP entries.
+const zipFlagEncrypted uint16 = 0x1
+
+// errSeekOffset is returned when seeking before the start of the content.
+var errSeekOffset = errors.New(`Seek to a negative position`)
+
+// zipHandler serves entries of a ZIP archive.
+type zipHandler struct {
+	entries map[string]*zipEntry
+}
+
+// zipEntry is a single file of a ZIP archive.
+type zipEntry struct {
+	*zip.File
+	// r is the archive the file is read from.
+	r io.ReaderAt
+	// offset is the position of the file data in the archive.
+	offset      int64
+	contentType string
+}
+
+// NewZipHandler returns a handler serving the files of the ZIP archive read
+// from r of the given size at their paths within the archive, with
+// "index.html" served for directories.
+//
+// Files stored with the "deflate" method are sent as they are stored, in the
+// "gzip" or "deflate" content coding, to clients accepting either. Only clients
+// accepting neither get the files decompressed. Files stored without
+// compression are sent as they are and can still be compressed by the
+// middleware. Conditional and range requests are supported for all of them,
+// with a distinct strong "ETag" for every content coding. Encrypted files and
+// files stored with any other method are not served.
+func NewZipHandler(r io.ReaderAt, size int64) (*zipHandler, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &zipHandler{entries: make(map[string]*zipEntry, len(z.File))}
+	for _, f := range z.File {
+		if f.Mode().IsDir() || f.Flags&zipFlagEncrypted != 0 || (f.Method != zip.Store && f.Method != zip.Deflate) {
+			continue
+		}
+		e := &zipEntry{File: f, r: r}
+		if e.offset, err = f.DataOffset(); err != nil {
+			return nil, err
+		}
+		if e.contentType = mime.TypeByExtension(path.Ext(f.Name)); e.contentType == `` {
+			var b [512]byte
+			n, _ := io.ReadFull(e.identity(), b[:])
+			e.contentType = http.DetectContentType(b[:n])
+		}
+		h.entries[strings.TrimPrefix(path.Clean(`/`+f.Name), `/`)] = e
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *zipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveStatic(w, r, func(name string) (staticFile, error) {
+		if e, ok := h.entries[name]; ok {
+			return e, nil
+		}
+		return nil, fs.ErrNotExist
+	})
+}
+
+// info implements staticFile.
+func (e *zipEntry) info() (string, []string) {
+	if e.Method == zip.Deflate {
+		return e.contentType, zipEncodings
+	}
+
+	return e.contentType, nil
+}
+
+// open implements staticFile.
+func (e *zipEntry) open(encoding string) (staticContent, error) {
+	c := staticContent{encoding: encoding, etag: e.etag(encoding), modTime: e.Modified}
+	switch {
+	case encoding == headerGzip:
+		c.ReadSeeker = e.gzip()
+	case encoding == headerDeflate || e.Method == zip.Store:
+		c.ReadSeeker = io.NewSectionReader(e.r, e.offset, int64(e.CompressedSize64))
+	default:
+		c.ReadSeeker = e.identity()
+	}
+
+	return c, nil
+}
+
+// identity returns the decompressed content of the entry.
+func (e *zipEntry) identity() io.ReadSeeker {
+	return &streamSeeker{open: func() (io.ReadCloser, error) { return e.Open() }, size: int64(e.UncompressedSize64)}
+}
+
+// gzip returns the deflated content of the entry wrapped in a gzip header and
+// trailer.
+func (e *zipEntry) gzip() io.ReadSeeker {
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], e.CRC32)
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(e.UncompressedSize64))
+
+	return &streamSeeker{
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(io.MultiReader(
+				bytes.NewReader(gzipHeader),
+				io.NewSectionReader(e.r, e.offset, int64(e.CompressedSize64)),
+				bytes.NewReader(trailer[:]),
+			)), nil
+		},
+		size: int64(len(gzipHeader)) + int64(e.CompressedSize64) + int64(len(trailer)),
+	}
+}
+
+// etag returns the strong entity tag of the entry sent in the given content
+// coding, derived from the checksum and size of its content.
+func (e *zipEntry) etag(encoding string) string {
+	if encoding == `` {
+		return fmt.Sprintf(`"%08x-%x"`, e.CRC32, e.UncompressedSize64)
+	}
+
+	return fmt.Sprintf(`"%08x-%x-%s"`, e.CRC32, e.UncompressedSize64, encoding)
+}
+
+// streamSeeker is a ReadSeeker over a stream of known size that can only be
+// read sequentially. Seeking forward skips the stream data and seeking
+// backward opens the stream again.
+type streamSeeker struct {
+	open func() (io.ReadCloser, error)
+	size int64
+	// pos is the position of the next read and off the position of rc.
+	pos, off int64
+	rc       io.ReadCloser
+}
+
+// Read implements io.Reader.
+func (s *streamSeeker) Read(b []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+
+	if s.rc == nil || s.off > s.pos {
+		if s.rc != nil {
+			s.rc.Close()
+		}
+		rc, err := s.open()
+		if err != nil {
+			return 0, err
+		}
+		s.rc, s.off = rc, 0
+	}
+	if s.off < s.pos {
+		n, err := io.CopyN(io.Discard, s.rc, s.pos-s.off)
+		s.off += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rest := s.size - s.pos; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	n, err := s.rc.Read(b)
+	s.pos += int64(n)
+	s.off += int64(n)
+	if err == io.EOF && s.pos < s.size {
+		err = io.ErrUnexpectedEOF
+	}
+	if s.pos == s.size {
+		// Nothing more is read unless seeking back, which opens it again.
+		s.rc.Close()
+		s.rc = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (s *streamSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errSeekOffset
+	}
+
+	s.pos = offset
+	return offset, nil
+}
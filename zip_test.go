@@ -0,0 +1,163 @@
+// Copyright 2016 Igor "Mocheryl" Zornik. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package negronicompress
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestZip(t *testing.T, files map[string]uint16) (*bytes.Reader, string) {
+	cnt := strings.Repeat(`zipped content `, 1000)
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for name, method := range files {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(cnt))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(b.Bytes()), cnt
+}
+
+func TestZipHandler(t *testing.T) {
+	r, cnt := newTestZip(t, map[string]uint16{`app/index.html`: zip.Deflate, `app/app.js`: zip.Store})
+	handler, err := NewZipHandler(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etags := make(map[string]bool)
+	for _, e := range []struct {
+		path, accept  string
+		code          int
+		encoding, typ string
+	}{
+		{`/app/`, `gzip, deflate`, http.StatusOK, headerGzip, `text/html; charset=utf-8`},
+		{`/app/index.html`, `deflate`, http.StatusOK, headerDeflate, `text/html; charset=utf-8`},
+		{`/app/index.html`, ``, http.StatusOK, ``, `text/html; charset=utf-8`},
+		{`/app/app.js`, `gzip`, http.StatusOK, ``, `text/javascript; charset=utf-8`},
+		{`/app/missing.js`, `gzip`, http.StatusNotFound, ``, `text/plain; charset=utf-8`},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost`+e.path, nil)
+		req.Header.Set(headerAcceptEncoding, e.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		ce := w.Header().Get(headerContentEncoding)
+		if w.Code != e.code || ce != e.encoding || w.Header().Get(headerContentType) != e.typ {
+			t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %s with %q = %d, %q, %q; want %d, %q, %q`, e.path, e.accept, w.Code, ce, w.Header().Get(headerContentType), e.code, e.encoding, e.typ)
+			continue
+		}
+		if e.code != http.StatusOK {
+			continue
+		}
+		b := w.Body.Bytes()
+		if ce != `` {
+			dec, _ := NewDecoder(w.Body, ce)
+			b, err = io.ReadAll(dec)
+			if err != nil {
+				t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %s with %q sent invalid %s: %v`, e.path, e.accept, ce, err)
+				continue
+			}
+		}
+		if string(b) != cnt {
+			t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %s with %q decoded to %d bytes, want %d`, e.path, e.accept, len(b), len(cnt))
+		}
+
+		etags[w.Header().Get(headerETag)] = true
+	}
+	// Every content coding of the same file needs its own strong ETag.
+	if len(etags) != 3 {
+		t.Errorf(`negronicompress.zipHandler.ServeHTTP() sent %d distinct ETags, want 3`, len(etags))
+	}
+}
+
+func TestZipHandler_Encrypted(t *testing.T) {
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for _, flags := range []uint16{0, zipFlagEncrypted} {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf(`%d.txt`, flags), Method: zip.Deflate, Flags: flags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(`not really encrypted`))
+	}
+	z.Close()
+
+	r := bytes.NewReader(b.Bytes())
+	handler, err := NewZipHandler(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []struct {
+		path string
+		code int
+	}{
+		{`/0.txt`, http.StatusOK},
+		{`/1.txt`, http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest(`GET`, `http://localhost`+e.path, nil)
+		req.Header.Set(headerAcceptEncoding, headerGzip)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != e.code {
+			t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %s = %d, want %d`, e.path, w.Code, e.code)
+		}
+	}
+}
+
+func TestZipHandler_Range(t *testing.T) {
+	r, _ := newTestZip(t, map[string]uint16{`log.txt`: zip.Deflate})
+	handler, _ := NewZipHandler(r, r.Size())
+
+	for _, accept := range []string{headerGzip, headerIdentity} {
+		req, _ := http.NewRequest(`GET`, `http://localhost/log.txt`, nil)
+		req.Header.Set(headerAcceptEncoding, accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		full, etag := w.Body.Bytes(), w.Header().Get(headerETag)
+
+		for _, e := range []struct {
+			rng, ifRange string
+			code         int
+			body         []byte
+		}{
+			{`bytes=5-`, ``, http.StatusPartialContent, full[5:]},
+			{`bytes=0-9`, etag, http.StatusPartialContent, full[:10]},
+			{`bytes=-8`, ``, http.StatusPartialContent, full[len(full)-8:]},
+			{`bytes=0-9`, `"stale"`, http.StatusOK, full},
+		} {
+			req.Header.Set(`Range`, e.rng)
+			req.Header.Set(`If-Range`, e.ifRange)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != e.code || !bytes.Equal(w.Body.Bytes(), e.body) {
+				t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %q with range %q and If-Range %q = %d, %d bytes; want %d, %d bytes`, accept, e.rng, e.ifRange, w.Code, w.Body.Len(), e.code, len(e.body))
+			}
+		}
+
+		req.Header.Del(`Range`)
+		req.Header.Del(`If-Range`)
+		req.Header.Set(`If-None-Match`, etag)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Errorf(`negronicompress.zipHandler.ServeHTTP() for %q with matching If-None-Match = %d, want %d`, accept, w.Code, http.StatusNotModified)
+		}
+	}
+}